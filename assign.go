@@ -0,0 +1,170 @@
+package xmlrpc
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// assign stores v, a value as returned by the decoder, into dst. Arrays
+// are assigned to slices and arrays, and Structs to maps with string keys
+// or to structs, matching member names to the members of typeFields
+// exactly first and case-insensitively next.
+func assign(dst reflect.Value, v interface{}) error {
+	if dst.Kind() == reflect.Ptr {
+		if v == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), v)
+	}
+	if v == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	sv := reflect.ValueOf(v)
+	if dst.Kind() == reflect.Interface {
+		if !sv.Type().Implements(dst.Type()) {
+			return assignError(dst, v)
+		}
+		dst.Set(sv)
+		return nil
+	}
+	if sv.Type() == dst.Type() || dst.Type() == timeType {
+		if !sv.Type().AssignableTo(dst.Type()) {
+			return assignError(dst, v)
+		}
+		dst.Set(sv)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return assignError(dst, v)
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := v.(int)
+		if !ok || dst.OverflowInt(int64(i)) {
+			return assignError(dst, v)
+		}
+		dst.SetInt(int64(i))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, ok := v.(int)
+		if !ok || i < 0 || dst.OverflowUint(uint64(i)) {
+			return assignError(dst, v)
+		}
+		dst.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch n := v.(type) {
+		case float64:
+			f = n
+		case int:
+			f = float64(n)
+		default:
+			return assignError(dst, v)
+		}
+		if dst.OverflowFloat(f) && !math.IsInf(f, 0) {
+			return assignError(dst, v)
+		}
+		dst.SetFloat(f)
+	case reflect.String:
+		s, ok := v.(string)
+		if !ok {
+			return assignError(dst, v)
+		}
+		dst.SetString(s)
+	case reflect.Slice:
+		if b, ok := v.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes(b)
+			return nil
+		}
+		a, ok := v.(Array)
+		if !ok {
+			return assignError(dst, v)
+		}
+		s := reflect.MakeSlice(dst.Type(), len(a), len(a))
+		for i, e := range a {
+			if err := assign(s.Index(i), e); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+	case reflect.Array:
+		a, ok := v.(Array)
+		if !ok || len(a) > dst.Len() {
+			return assignError(dst, v)
+		}
+		for i := 0; i < dst.Len(); i++ {
+			var e interface{}
+			if i < len(a) {
+				e = a[i]
+			}
+			if err := assign(dst.Index(i), e); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		st, ok := v.(Struct)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return assignError(dst, v)
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(st))
+		for name, e := range st {
+			ev := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(ev, e); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(name).Convert(dst.Type().Key()), ev)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		st, ok := v.(Struct)
+		if !ok {
+			return assignError(dst, v)
+		}
+		for name, e := range st {
+			f := structField(dst, name)
+			if !f.IsValid() {
+				continue
+			}
+			if err := assign(f, e); err != nil {
+				return err
+			}
+		}
+	default:
+		return assignError(dst, v)
+	}
+	return nil
+}
+
+// structField returns the field of v for the member name, as given by
+// typeFields.
+func structField(v reflect.Value, name string) reflect.Value {
+	fields := cachedTypeFields(v.Type())
+	for _, f := range fields {
+		if f.name == name {
+			return fieldByIndex(v, f.index, true)
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return fieldByIndex(v, f.index, true)
+		}
+	}
+	return reflect.Value{}
+}
+
+func assignError(dst reflect.Value, v interface{}) error {
+	return fmt.Errorf("cannot assign %T to %s", v, dst.Type())
+}
@@ -0,0 +1,33 @@
+package xmlrpc
+
+import "context"
+
+// PendingCall represents a call started by Client.Go.
+type PendingCall struct {
+	Method string
+	Args   []interface{}
+	Reply  Array // the params of the response, once complete
+	Error  error // the error of the call, once complete
+	// Done receives the call itself once it is complete.
+	Done chan *PendingCall
+}
+
+// Go invokes the method name with args asynchronously and returns the
+// pending call, whose Done channel receives it once it is complete.
+func (c *Client) Go(name string, args ...interface{}) *PendingCall {
+	return c.GoContext(context.Background(), name, args...)
+}
+
+// GoContext is like Go, aborting the call if ctx is done.
+func (c *Client) GoContext(ctx context.Context, name string, args ...interface{}) *PendingCall {
+	pc := &PendingCall{
+		Method: name,
+		Args:   args,
+		Done:   make(chan *PendingCall, 1),
+	}
+	go func() {
+		pc.Reply, pc.Error = c.invoke(ctx, name, args, nil)
+		pc.Done <- pc
+	}()
+	return pc
+}
@@ -0,0 +1,56 @@
+package xmlrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClientGo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, args, err := Unmarshal(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if args[0] == "slow" {
+			<-r.Context().Done()
+			return
+		}
+		Marshal(w, "", args...)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	calls := make([]*PendingCall, 20)
+	for i := range calls {
+		calls[i] = client.Go("echo", i)
+	}
+	for i, pc := range calls {
+		done := <-pc.Done
+		if done != pc {
+			t.Fatal("Done should receive the call itself")
+		}
+		if pc.Error != nil {
+			t.Fatal(pc.Error)
+		}
+		if !reflect.DeepEqual(pc.Reply, Array{i}) {
+			t.Fatalf("response different from expected (%+v)", pc.Reply)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pc := client.GoContext(ctx, "echo", "slow")
+	cancel()
+	select {
+	case <-pc.Done:
+		if pc.Error == nil {
+			t.Fatal("expected error for cancelled call")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled call did not complete")
+	}
+}
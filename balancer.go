@@ -0,0 +1,194 @@
+package xmlrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balancing is the policy selecting the endpoint of each call.
+type Balancing int
+
+const (
+	// RoundRobin uses the endpoints in turn.
+	RoundRobin Balancing = iota
+	// LeastInFlight uses the endpoint with the fewest calls in flight.
+	LeastInFlight
+)
+
+// Balancer spreads the calls of a Client over several endpoints. An
+// endpoint failing EjectAfter times in a row is ejected for EjectFor,
+// after which it gets calls again but is ejected on its first failure
+// until it succeeds. Failures are the errors which the Retry policy of the
+// Client, or the default RetryPolicy, deems retryable.
+//
+// Calls which could not be sent, as when the connection is refused, fail
+// over to the next endpoint at once. If the Client has a Retry policy,
+// calls to the methods it allows also fail over on the errors it deems
+// retryable, even though they may have been served; non-idempotent methods
+// should be left out of Retry.Methods so that they are not replayed. Each
+// request, including those failing over, counts as one of the attempts of
+// the policy, and goes through the CircuitBreaker and RateLimit of the
+// Client.
+type Balancer struct {
+	// Policy selects the endpoint of each call.
+	Policy Balancing
+	// EjectAfter is the number of consecutive failures ejecting an
+	// endpoint. Zero means 3.
+	EjectAfter int
+	// EjectFor is how long an ejected endpoint gets no calls. Zero means
+	// 30s.
+	EjectFor time.Duration
+
+	endpoints []*endpoint
+	next      uint64
+}
+
+type endpoint struct {
+	url      string
+	inFlight int64
+
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+}
+
+// NewBalancer returns a balancer over urls.
+func NewBalancer(urls ...string) *Balancer {
+	b := &Balancer{}
+	for _, url := range urls {
+		b.endpoints = append(b.endpoints, &endpoint{url: url})
+	}
+	return b
+}
+
+// NewMultiClient returns a Client spreading its calls over urls, using
+// round-robin and failing over between them.
+func NewMultiClient(urls ...string) *Client {
+	c := NewClient("")
+	c.Balancer = NewBalancer(urls...)
+	return c
+}
+
+// Healthy returns the URLs of the endpoints which are not ejected.
+func (b *Balancer) Healthy() []string {
+	var urls []string
+	now := time.Now()
+	for _, ep := range b.endpoints {
+		if !ep.ejected(now) {
+			urls = append(urls, ep.url)
+		}
+	}
+	return urls
+}
+
+func (ep *endpoint) ejected(now time.Time) bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return now.Before(ep.ejectedUntil)
+}
+
+func (b *Balancer) ejectAfter() int {
+	if b.EjectAfter > 0 {
+		return b.EjectAfter
+	}
+	return 3
+}
+
+func (b *Balancer) ejectFor() time.Duration {
+	if b.EjectFor > 0 {
+		return b.EjectFor
+	}
+	return 30 * time.Second
+}
+
+// pick returns the endpoint for the next attempt among those not tried
+// yet, preferring endpoints which are not ejected.
+func (b *Balancer) pick(tried map[*endpoint]bool) *endpoint {
+	now := time.Now()
+	var candidates []*endpoint
+	for _, healthy := range []bool{true, false} {
+		for _, ep := range b.endpoints {
+			if !tried[ep] && (!healthy || !ep.ejected(now)) {
+				candidates = append(candidates, ep)
+			}
+		}
+		if len(candidates) > 0 {
+			break
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	start := int(atomic.AddUint64(&b.next, 1) % uint64(len(candidates)))
+	best := candidates[start]
+	if b.Policy == LeastInFlight {
+		for i := 1; i < len(candidates); i++ {
+			ep := candidates[(start+i)%len(candidates)]
+			if atomic.LoadInt64(&ep.inFlight) < atomic.LoadInt64(&best.inFlight) {
+				best = ep
+			}
+		}
+	}
+	return best
+}
+
+// done records the outcome of a call to ep.
+func (b *Balancer) done(ep *endpoint, failed bool) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if !failed {
+		ep.failures = 0
+		return
+	}
+	ep.failures++
+	if ep.failures >= b.ejectAfter() {
+		ep.ejectedUntil = time.Now().Add(b.ejectFor())
+		// a single failure ejects it again once it is back
+		ep.failures = b.ejectAfter() - 1
+	}
+}
+
+// send sends body to the endpoints in turn until one succeeds or fails
+// with an error which does not fail over. If max is positive, the call may
+// be retried and at most max requests are made, failing over on the errors
+// which the Retry policy of c deems retryable if it allows name. Otherwise
+// only the requests which could not be sent fail over. send returns the number of requests
+// made.
+func (b *Balancer) send(ctx context.Context, c *Client, name string, body func() (io.Reader, error), decode decodeFunc, max int) (Array, int, error) {
+	policy := c.Retry
+	if policy == nil {
+		policy = &RetryPolicy{}
+	}
+	tried := make(map[*endpoint]bool, len(b.endpoints))
+	n := 0
+	err := errors.New("no endpoint")
+	for ep := b.pick(tried); ep != nil && (max <= 0 || n < max); ep = b.pick(tried) {
+		tried[ep] = true
+		n++
+		atomic.AddInt64(&ep.inFlight, 1)
+		var v Array
+		v, err = c.send(ctx, ep.url, name, body, decode)
+		atomic.AddInt64(&ep.inFlight, -1)
+		if ctx.Err() != nil {
+			return v, n, err
+		}
+		failed := err != nil && policy.retryable(err)
+		b.done(ep, failed)
+		if !unsent(err) && !(failed && max > 0 && c.Retry.allows(name)) {
+			return v, n, err
+		}
+	}
+	return nil, n, err
+}
+
+// unsent reports whether err shows that a request was never sent, so that
+// it can be sent to another endpoint whatever its method.
+func unsent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
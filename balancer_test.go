@@ -0,0 +1,204 @@
+package xmlrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newNamedServer(name string, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		Marshal(w, "", name)
+	}))
+}
+
+func TestMultiClientRoundRobin(t *testing.T) {
+	var callsA, callsB int32
+	a, b := newNamedServer("a", &callsA), newNamedServer("b", &callsB)
+	defer a.Close()
+	defer b.Close()
+
+	client := NewMultiClient(a.URL, b.URL)
+	for i := 0; i < 10; i++ {
+		if _, err := client.Call("Irrelevant"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if callsA != 5 || callsB != 5 {
+		t.Fatalf("calls not balanced: %d and %d", callsA, callsB)
+	}
+}
+
+func TestMultiClientLeastInFlight(t *testing.T) {
+	var callsA, callsB int32
+	a, b := newNamedServer("a", &callsA), newNamedServer("b", &callsB)
+	defer a.Close()
+	defer b.Close()
+
+	client := NewMultiClient(a.URL, b.URL)
+	client.Balancer.Policy = LeastInFlight
+	client.Balancer.endpoints[0].inFlight = 10 // pretend a is busy
+	for i := 0; i < 4; i++ {
+		v, err := client.Call("Irrelevant")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, Array{"b"}) {
+			t.Fatalf("want least busy endpoint but got %v", v)
+		}
+	}
+}
+
+func TestMultiClientFailover(t *testing.T) {
+	var callsA, callsB int32
+	a := newNamedServer("a", &callsA)
+	defer a.Close()
+	b := newNamedServer("b", &callsB)
+	b.Close()
+	c := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer c.Close()
+
+	client := NewMultiClient(a.URL, b.URL, c.URL)
+	client.Retry = &RetryPolicy{MaxAttempts: 3, AllMethods: true}
+	client.Balancer.EjectAfter = 1
+	client.Balancer.EjectFor = time.Hour
+	for i := 0; i < 6; i++ {
+		v, err := client.Call("Irrelevant")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, Array{"a"}) {
+			t.Fatalf("want healthy endpoint but got %v", v)
+		}
+	}
+	if healthy := client.Balancer.Healthy(); !reflect.DeepEqual(healthy, []string{a.URL}) {
+		t.Fatalf("want only %s healthy but got %v", a.URL, healthy)
+	}
+	if callsA != 6 {
+		t.Fatalf("want 6 calls to healthy endpoint but got %d", callsA)
+	}
+
+	a.Close()
+	if _, err := client.Call("Irrelevant"); err == nil {
+		t.Fatal("expected error when all endpoints fail")
+	}
+	if healthy := client.Balancer.Healthy(); len(healthy) != 0 {
+		t.Fatalf("want no healthy endpoint but got %v", healthy)
+	}
+}
+
+func TestMultiClientFailoverUnsent(t *testing.T) {
+	var callsA, callsB int32
+	a := newNamedServer("a", &callsA)
+	defer a.Close()
+	b := newNamedServer("b", &callsB)
+	b.Close()
+	c := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer c.Close()
+
+	client := NewMultiClient(b.URL, a.URL)
+	for i := 0; i < 4; i++ {
+		v, err := client.Call("Irrelevant")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, Array{"a"}) {
+			t.Fatalf("want healthy endpoint but got %v", v)
+		}
+	}
+
+	client = NewMultiClient(c.URL, a.URL)
+	var failures int
+	for i := 0; i < 4; i++ {
+		if _, err := client.Call("Irrelevant"); err != nil {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Fatalf("calls which were sent should not fail over without a Retry policy (%d failures)", failures)
+	}
+}
+
+func TestMultiClientNoFailover(t *testing.T) {
+	var calls [2]int32
+	servers := make([]*httptest.Server, 2)
+	for i := range servers {
+		n := &calls[i]
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(n, 1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer servers[i].Close()
+	}
+
+	client := NewMultiClient(servers[0].URL, servers[1].URL)
+	client.Retry = &RetryPolicy{MaxAttempts: 2, Methods: []string{"get"}}
+	if _, err := client.Call("set"); err == nil {
+		t.Fatal("expected error")
+	}
+	total := []int{int(calls[0]), int(calls[1])}
+	sort.Ints(total)
+	if !reflect.DeepEqual(total, []int{0, 1}) {
+		t.Fatalf("non-idempotent method should not fail over (%v calls)", total)
+	}
+	if _, err := client.Call("get"); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls[0]+calls[1] != 3 {
+		t.Fatalf("idempotent method should fail over (%d calls)", calls[0]+calls[1])
+	}
+}
+
+func TestMultiClientFailoverAttempts(t *testing.T) {
+	var calls int32
+	servers := make([]string, 3)
+	for i := range servers {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer ts.Close()
+		servers[i] = ts.URL
+	}
+
+	client := NewMultiClient(servers...)
+	client.Retry = &RetryPolicy{MaxAttempts: 2, AllMethods: true, Backoff: time.Millisecond}
+	if _, err := client.Call("Irrelevant"); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != 2 {
+		t.Fatalf("failovers should count as attempts (%d calls)", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client = NewMultiClient(servers...)
+	client.Retry = &RetryPolicy{MaxAttempts: 5, AllMethods: true, Backoff: time.Millisecond}
+	client.Breaker = &CircuitBreaker{FailureThreshold: 2}
+	if _, err := client.Call("Irrelevant"); err != ErrCircuitOpen {
+		t.Fatalf("want %v but got %v", ErrCircuitOpen, err)
+	}
+	if calls != 2 {
+		t.Fatalf("the breaker should see every request (%d calls)", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client = NewMultiClient(servers...)
+	client.Retry = &RetryPolicy{MaxAttempts: 3, AllMethods: true}
+	client.RateLimit = NewRateLimit(20, 1)
+	start := time.Now()
+	if _, err := client.Call("Irrelevant"); err == nil {
+		t.Fatal("expected error")
+	}
+	if d := time.Since(start); calls != 3 || d < 90*time.Millisecond {
+		t.Fatalf("every request should be rate limited (%d calls in %v)", calls, d)
+	}
+}
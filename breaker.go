@@ -0,0 +1,201 @@
+package xmlrpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by calls rejected by an open CircuitBreaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects every call with ErrCircuitOpen.
+	BreakerOpen
+	// BreakerHalfOpen lets a single trial call through at a time.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops a Client from calling an endpoint which keeps
+// failing. After FailureThreshold consecutive failures the circuit opens
+// and calls fail fast with ErrCircuitOpen. Once OpenTimeout has elapsed it
+// is half-open and lets trial calls through, one at a time: a failure
+// opens it again, while SuccessThreshold successes close it.
+//
+// By default every error counts as a failure except faults, which show
+// that the server is up, HTTP 4xx statuses and calls whose context is
+// done.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures opening the
+	// circuit. Zero means 5.
+	FailureThreshold int
+	// SuccessThreshold is the number of successful trial calls closing a
+	// half-open circuit. Zero means 1.
+	SuccessThreshold int
+	// OpenTimeout is how long the circuit stays open before turning
+	// half-open. Zero means 30s.
+	OpenTimeout time.Duration
+	// CountFaults makes faults count as failures.
+	CountFaults bool
+	// IsFailure, if non-nil, replaces the classification above and
+	// reports whether a call failing with err counts as a failure. Errors
+	// of the reply of CallInto or the visitor of CallWalk never count.
+	IsFailure func(err error) bool
+	// OnStateChange, if non-nil, is called whenever the state changes,
+	// e.g. for alerting.
+	OnStateChange func(from, to BreakerState)
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	successes int
+	openedAt  time.Time
+	trial     bool   // a trial call is in flight
+	gen       uint64 // incremented by every change of state
+}
+
+// State returns the current state of the circuit.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.openTimeout() {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *CircuitBreaker) openTimeout() time.Duration {
+	if b.OpenTimeout > 0 {
+		return b.OpenTimeout
+	}
+	return 30 * time.Second
+}
+
+func (b *CircuitBreaker) isFailure(err error) bool {
+	if isCallerError(err) {
+		return false
+	}
+	if b.IsFailure != nil {
+		return b.IsFailure(err)
+	}
+	var (
+		fault     *Fault
+		statusErr *StatusError
+	)
+	switch {
+	case errors.As(err, &fault):
+		return b.CountFaults
+	case errors.As(err, &statusErr):
+		return statusErr.Code/100 != 4
+	}
+	return true
+}
+
+// setState changes the state and returns the callback to run once the
+// lock is released.
+func (b *CircuitBreaker) setState(to BreakerState) func() {
+	from := b.state
+	b.state = to
+	b.gen++
+	b.failures = 0
+	b.successes = 0
+	if to == BreakerOpen {
+		b.openedAt = time.Now()
+	}
+	if b.OnStateChange == nil || from == to {
+		return func() {}
+	}
+	return func() { b.OnStateChange(from, to) }
+}
+
+// allow reports whether a call may proceed, in which case done must be
+// called with its outcome and the returned generation. A nil breaker
+// allows every call.
+func (b *CircuitBreaker) allow() (uint64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	b.mu.Lock()
+	notify := func() {}
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.openTimeout() {
+		notify = b.setState(BreakerHalfOpen)
+	}
+	var err error
+	switch {
+	case b.state == BreakerOpen:
+		err = ErrCircuitOpen
+	case b.state == BreakerHalfOpen && b.trial:
+		err = ErrCircuitOpen
+	case b.state == BreakerHalfOpen:
+		b.trial = true
+	}
+	gen := b.gen
+	b.mu.Unlock()
+	notify()
+	return gen, err
+}
+
+// done records the outcome of a call allowed by allow in generation gen.
+// Outcomes of calls allowed before the last change of state are ignored,
+// so that a slow call cannot end the trial of a later one, nor close or
+// reopen the circuit.
+func (b *CircuitBreaker) done(ctx context.Context, gen uint64, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	if gen != b.gen {
+		b.mu.Unlock()
+		return
+	}
+	notify := func() {}
+	halfOpen := b.state == BreakerHalfOpen
+	if halfOpen {
+		b.trial = false
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// the caller gave up, which says nothing about the server
+	case err != nil && b.isFailure(err):
+		b.failures++
+		threshold := b.FailureThreshold
+		if threshold <= 0 {
+			threshold = 5
+		}
+		if halfOpen || b.failures >= threshold {
+			notify = b.setState(BreakerOpen)
+		}
+	default:
+		b.failures = 0
+		if halfOpen {
+			b.successes++
+			threshold := b.SuccessThreshold
+			if threshold <= 0 {
+				threshold = 1
+			}
+			if b.successes >= threshold {
+				notify = b.setState(BreakerClosed)
+			}
+		}
+	}
+	b.mu.Unlock()
+	notify()
+}
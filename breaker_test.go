@@ -0,0 +1,159 @@
+package xmlrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		failing int32 = 1
+		calls   int32
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		Marshal(w, "", true)
+	}))
+	defer ts.Close()
+
+	var (
+		mu          sync.Mutex
+		transitions []string
+	)
+	breaker := &CircuitBreaker{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+		OnStateChange: func(from, to BreakerState) {
+			mu.Lock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+			mu.Unlock()
+		},
+	}
+	client := NewClient(ts.URL)
+	client.Breaker = breaker
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Call("Irrelevant"); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("want server error but got %v", err)
+		}
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("want open circuit but got %v", breaker.State())
+	}
+	if _, err := client.Call("Irrelevant"); err != ErrCircuitOpen {
+		t.Fatalf("want %v but got %v", ErrCircuitOpen, err)
+	}
+	if calls != 2 {
+		t.Fatalf("open circuit should not call the server (%d calls)", calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if breaker.State() != BreakerHalfOpen {
+		t.Fatalf("want half-open circuit but got %v", breaker.State())
+	}
+	if _, err := client.Call("Irrelevant"); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("want server error but got %v", err)
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("failed trial should open the circuit, got %v", breaker.State())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	atomic.StoreInt32(&failing, 0)
+	if _, err := client.Call("Irrelevant"); err != nil {
+		t.Fatal(err)
+	}
+	if breaker.State() != BreakerClosed {
+		t.Fatalf("want closed circuit but got %v", breaker.State())
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(transitions, want) {
+		t.Fatalf("want transitions %v but got %v", want, transitions)
+	}
+}
+
+func TestCircuitBreakerClassification(t *testing.T) {
+	fault := NewFault(1, "failed")
+	breaker := &CircuitBreaker{}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fault, false},
+		{&StatusError{Code: http.StatusNotFound}, false},
+		{&StatusError{Code: http.StatusServiceUnavailable}, true},
+		{ErrQueueFull, true},
+	}
+	for _, test := range tests {
+		if got := breaker.isFailure(test.err); got != test.want {
+			t.Fatalf("%v: want %v but got %v", test.err, test.want, got)
+		}
+	}
+	breaker.CountFaults = true
+	if !breaker.isFailure(fault) {
+		t.Fatal("fault should count with CountFaults")
+	}
+	breaker.IsFailure = func(err error) bool { return false }
+	if breaker.isFailure(&StatusError{Code: http.StatusServiceUnavailable}) {
+		t.Fatal("IsFailure should replace the classification")
+	}
+}
+
+func TestCircuitBreakerHalfOpenTrial(t *testing.T) {
+	breaker := &CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Millisecond}
+	gen, err := breaker.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	breaker.done(context.Background(), gen, ErrQueueFull)
+	time.Sleep(2 * time.Millisecond)
+	if _, err := breaker.allow(); err != nil {
+		t.Fatalf("want trial call but got %v", err)
+	}
+	if _, err := breaker.allow(); err != ErrCircuitOpen {
+		t.Fatalf("want %v during trial but got %v", ErrCircuitOpen, err)
+	}
+}
+
+func TestCircuitBreakerStaleCalls(t *testing.T) {
+	breaker := &CircuitBreaker{FailureThreshold: 1, OpenTimeout: 10 * time.Millisecond}
+	ctx := context.Background()
+	slow, _ := breaker.allow()
+	gen, _ := breaker.allow()
+	breaker.done(ctx, gen, ErrQueueFull)
+	if state := breaker.State(); state != BreakerOpen {
+		t.Fatalf("want open circuit but got %v", state)
+	}
+	// a call started before the circuit opened neither closes it nor
+	// restarts its timeout
+	breaker.done(ctx, slow, nil)
+	time.Sleep(5 * time.Millisecond)
+	breaker.done(ctx, slow, ErrQueueFull)
+	time.Sleep(6 * time.Millisecond)
+	trial, err := breaker.allow()
+	if err != nil {
+		t.Fatalf("want trial call but got %v", err)
+	}
+	// nor ends the trial of a later call
+	breaker.done(ctx, slow, nil)
+	if _, err := breaker.allow(); err != ErrCircuitOpen {
+		t.Fatalf("want %v during trial but got %v", ErrCircuitOpen, err)
+	}
+	breaker.done(ctx, trial, nil)
+	if state := breaker.State(); state != BreakerClosed {
+		t.Fatalf("want closed circuit after the trial but got %v", state)
+	}
+}
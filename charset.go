@@ -0,0 +1,168 @@
+package xmlrpc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// cp1252 maps the bytes 0x80-0x9F of Windows-1252 to unicode. The five
+// unassigned bytes map to the matching C1 control characters.
+var cp1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+type charset int
+
+const (
+	charsetASCII charset = iota
+	charsetLatin1
+	charsetWindows1252
+)
+
+func lookupCharset(name string) (charset, bool) {
+	switch strings.ToLower(name) {
+	case "us-ascii", "ascii":
+		return charsetASCII, true
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "latin-1", "l1":
+		return charsetLatin1, true
+	case "windows-1252", "cp1252":
+		return charsetWindows1252, true
+	}
+	return 0, false
+}
+
+// decode returns the unicode character for byte b.
+func (cs charset) decode(b byte) rune {
+	if cs == charsetWindows1252 && b >= 0x80 && b < 0xA0 {
+		return cp1252[b-0x80]
+	}
+	return rune(b)
+}
+
+// encode returns the byte for unicode character r, if there is one.
+func (cs charset) encode(r rune) (byte, bool) {
+	switch {
+	case r < 0x80:
+		return byte(r), true
+	case cs == charsetASCII:
+		return 0, false
+	case cs == charsetWindows1252 && r >= 0x80 && r < 0xA0:
+		// C1 controls only exist where Windows-1252 leaves a hole.
+		return byte(r), cp1252[r-0x80] == r
+	case r < 0x100:
+		return byte(r), true
+	case cs == charsetWindows1252:
+		for i, c := range cp1252 {
+			if c == r {
+				return byte(0x80 + i), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// CharsetReader returns a reader converting input from charset to UTF-8.
+// It supports US-ASCII, ISO-8859-1 (Latin-1) and Windows-1252, and is
+// used by Decoder when no other CharsetReader is set.
+func CharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	cs, ok := lookupCharset(charset)
+	if !ok {
+		return nil, fmt.Errorf("unsupported charset: %q", charset)
+	}
+	return &charsetReader{cs: cs, r: bufio.NewReader(input)}, nil
+}
+
+type charsetReader struct {
+	cs  charset
+	r   *bufio.Reader
+	buf [utf8.UTFMax]byte
+	n   int // pending bytes in buf
+}
+
+func (cr *charsetReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if cr.n > 0 {
+			c := copy(p[n:], cr.buf[:cr.n])
+			copy(cr.buf[:], cr.buf[c:cr.n])
+			cr.n -= c
+			n += c
+			continue
+		}
+		if n > 0 && cr.r.Buffered() == 0 {
+			break
+		}
+		b, err := cr.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if b < 0x80 {
+			p[n] = b
+			n++
+			continue
+		}
+		cr.n = utf8.EncodeRune(cr.buf[:], cr.cs.decode(b))
+	}
+	return n, nil
+}
+
+// CharsetWriter returns a writer converting UTF-8 output to charset.
+// Characters that charset cannot represent are written as XML character
+// references, which keeps the document intact as long as they only occur
+// in character data. It supports the same charsets as CharsetReader and
+// is used by Encoder when no other CharsetWriter is set.
+func CharsetWriter(charset string, output io.Writer) (io.Writer, error) {
+	cs, ok := lookupCharset(charset)
+	if !ok {
+		return nil, fmt.Errorf("unsupported charset: %q", charset)
+	}
+	return &charsetWriter{cs: cs, w: output}, nil
+}
+
+type charsetWriter struct {
+	cs      charset
+	w       io.Writer
+	pending []byte // incomplete UTF-8 sequence from the previous Write
+	out     []byte
+}
+
+func (cw *charsetWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(cw.pending) > 0 {
+		p = append(cw.pending, p...)
+		cw.pending = nil
+	}
+	out := cw.out[:0]
+	for len(p) > 0 {
+		if p[0] < utf8.RuneSelf {
+			out = append(out, p[0])
+			p = p[1:]
+			continue
+		}
+		if !utf8.FullRune(p) {
+			cw.pending = append(cw.pending, p...)
+			break
+		}
+		r, size := utf8.DecodeRune(p)
+		p = p[size:]
+		if b, ok := cw.cs.encode(r); ok {
+			out = append(out, b)
+			continue
+		}
+		out = append(out, "&#"...)
+		out = strconv.AppendInt(out, int64(r), 10)
+		out = append(out, ';')
+	}
+	cw.out = out
+	if _, err := cw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,111 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalLatin1(t *testing.T) {
+	payload := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>" +
+		"<methodResponse><params><param><value><string>caf\xe9</string></value></param></params></methodResponse>"
+
+	_, v, e := Unmarshal(strings.NewReader(payload))
+	if e != nil {
+		t.Fatalf("could not unmarshal payload: %s", e)
+	}
+	if !reflect.DeepEqual(v, Array{"café"}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+}
+
+func TestUnmarshalWindows1252(t *testing.T) {
+	payload := "<?xml version=\"1.0\" encoding=\"windows-1252\"?>" +
+		"<methodResponse><params><param><value>\x80 \x93quoted\x94 \xe9</value></param></params></methodResponse>"
+
+	_, v, e := Unmarshal(strings.NewReader(payload))
+	if e != nil {
+		t.Fatalf("could not unmarshal payload: %s", e)
+	}
+	if !reflect.DeepEqual(v, Array{"€ “quoted” é"}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+}
+
+func TestDecoderCharsetReader(t *testing.T) {
+	payload := `<?xml version="1.0" encoding="x-custom"?>` +
+		`<methodResponse><params><param><value>ok</value></param></params></methodResponse>`
+
+	if _, _, e := Unmarshal(strings.NewReader(payload)); e == nil {
+		t.Fatal("expected error for unknown charset")
+	}
+
+	var got string
+	dec := NewDecoder(strings.NewReader(payload))
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		got = charset
+		return input, nil
+	}
+	_, v, e := dec.Decode()
+	if e != nil {
+		t.Fatalf("could not unmarshal payload: %s", e)
+	}
+	if got != "x-custom" || !reflect.DeepEqual(v, Array{"ok"}) {
+		t.Fatalf("response different from expected (%q, %+v)", got, v)
+	}
+}
+
+func TestEncoderEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.Encoding = "ISO-8859-1"
+	if err := enc.Encode("echo", "café €"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>" +
+		"<methodCall><methodName>echo</methodName><params><param><value>" +
+		"<string>caf\xe9 &#8364;</string></value></param></params></methodCall>"
+	if buf.String() != want {
+		t.Fatalf("want %q but got %q", want, buf.String())
+	}
+
+	name, v, e := Unmarshal(&buf)
+	if e != nil {
+		t.Fatalf("could not unmarshal payload: %s", e)
+	}
+	if name != "echo" || !reflect.DeepEqual(v, Array{"café €"}) {
+		t.Fatalf("response different from expected (%q, %+v)", name, v)
+	}
+}
+
+func TestClientEncoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "text/xml; charset=windows-1252" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		_, args, err := Unmarshal(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		enc := NewEncoder(w)
+		enc.Encoding = "windows-1252"
+		enc.Encode("", args...)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	client.EncoderOptions.Encoding = "windows-1252"
+	v, err := client.Call("echo", "“smart” quotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{"“smart” quotes"}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+}
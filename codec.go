@@ -0,0 +1,340 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"net/http"
+	"net/rpc"
+	"reflect"
+	"strings"
+)
+
+// rpcParams returns the params sent for the args of a net/rpc call. The
+// elements of an Array are sent as separate params, nil or a nil pointer
+// as no param, and anything else as a single param.
+func rpcParams(args interface{}) []interface{} {
+	if a, ok := args.(Array); ok {
+		return a
+	}
+	v := reflect.Indirect(reflect.ValueOf(args))
+	if !v.IsValid() {
+		return nil
+	}
+	return []interface{}{v.Interface()}
+}
+
+// assignParams stores the params of a call or response into x, a pointer.
+// A single param is assigned as is unless x points to a struct and the
+// param is not a Struct, in which case, as for several params, the params
+// are assigned to the fields of the struct in order. Otherwise the params
+// are assigned as an Array.
+func assignParams(x interface{}, params Array) error {
+	dst := reflect.ValueOf(x)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() {
+		return errors.New("destination must be a non-nil pointer")
+	}
+	dst = dst.Elem()
+	if dst.Kind() == reflect.Struct && dst.Type() != timeType {
+		if len(params) == 1 {
+			if _, ok := params[0].(Struct); ok {
+				return assign(dst, params[0])
+			}
+		}
+		n := 0
+		for _, f := range cachedTypeFields(dst.Type()) {
+			if n == len(params) {
+				break
+			}
+			fv := fieldByIndex(dst, f.index, true)
+			if !fv.IsValid() {
+				continue
+			}
+			if err := assign(fv, params[n]); err != nil {
+				return err
+			}
+			n++
+		}
+		if n < len(params) {
+			return errors.New("too many params")
+		}
+		return nil
+	}
+	if len(params) == 1 {
+		return assign(dst, params[0])
+	}
+	return assign(dst, params)
+}
+
+type clientResult struct {
+	seq    uint64
+	method string
+	params Array
+	err    error
+}
+
+type clientCodec struct {
+	client  *Client
+	ctx     context.Context
+	cancel  context.CancelFunc
+	results chan clientResult
+	result  clientResult
+}
+
+// NewClientCodec returns a net/rpc ClientCodec making its calls with
+// client, so that rpc.NewClientWithCodec gives a net/rpc Client talking
+// XMLRPC. The elements of an Array passed as args are sent as separate
+// params. Faults are reported as rpc.ServerError and lose their code.
+func NewClientCodec(client *Client) rpc.ClientCodec {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &clientCodec{
+		client:  client,
+		ctx:     ctx,
+		cancel:  cancel,
+		results: make(chan clientResult),
+	}
+}
+
+func (cc *clientCodec) WriteRequest(req *rpc.Request, args interface{}) error {
+	// req is reused by net/rpc once we return.
+	res := clientResult{seq: req.Seq, method: req.ServiceMethod}
+	params := rpcParams(args)
+	go func() {
+		res.params, res.err = cc.client.CallContext(cc.ctx, res.method, params...)
+		select {
+		case cc.results <- res:
+		case <-cc.ctx.Done():
+		}
+	}()
+	return nil
+}
+
+func (cc *clientCodec) ReadResponseHeader(resp *rpc.Response) error {
+	select {
+	case cc.result = <-cc.results:
+	case <-cc.ctx.Done():
+		return io.EOF
+	}
+	resp.Seq = cc.result.seq
+	resp.ServiceMethod = cc.result.method
+	resp.Error = ""
+	if cc.result.err != nil {
+		resp.Error = cc.result.err.Error()
+	}
+	return nil
+}
+
+func (cc *clientCodec) ReadResponseBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	return assignParams(x, cc.result.params)
+}
+
+func (cc *clientCodec) Close() error {
+	cc.cancel()
+	return nil
+}
+
+type serverCodec struct {
+	dec     *Decoder
+	enc     *Encoder
+	w       io.Writer
+	params  Array
+	bodyErr error // assigning the params failed
+}
+
+// NewServerCodec returns a net/rpc ServerCodec reading a single methodCall
+// from r and writing the methodResponse to w, for use with
+// rpc.Server.ServeRequest. See RPCHandler for serving over HTTP.
+func NewServerCodec(r io.Reader, w io.Writer) rpc.ServerCodec {
+	return &serverCodec{dec: NewDecoder(r), enc: NewEncoder(w), w: w}
+}
+
+func (sc *serverCodec) ReadRequestHeader(req *rpc.Request) error {
+	name, params, err := sc.dec.Decode()
+	if err == nil && name == "" {
+		err = errors.New("invalid request: missing methodCall")
+	}
+	if err != nil {
+		return err
+	}
+	req.ServiceMethod = name
+	req.Seq = 0
+	sc.params = params
+	return nil
+}
+
+func (sc *serverCodec) ReadRequestBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	sc.bodyErr = assignParams(x, sc.params)
+	return sc.bodyErr
+}
+
+func (sc *serverCodec) WriteResponse(resp *rpc.Response, reply interface{}) error {
+	if resp.Error != "" {
+		return sc.enc.EncodeFault(ToFault(rpcError(resp.Error, sc.bodyErr)))
+	}
+	// Encode the whole response first, so that a reply which cannot be
+	// encoded gives a fault rather than a truncated document.
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.EncoderOptions = sc.enc.EncoderOptions
+	if err := enc.Encode("", reflect.Indirect(reflect.ValueOf(reply)).Interface()); err != nil {
+		return sc.enc.EncodeFault(ToFault(err))
+	}
+	_, err := sc.w.Write(buf.Bytes())
+	return err
+}
+
+func (sc *serverCodec) Close() error {
+	return nil
+}
+
+// rpcError returns the error for the error message of a net/rpc response,
+// bodyErr being the error assigning the params, if any.
+func rpcError(msg string, bodyErr error) error {
+	switch {
+	case bodyErr != nil:
+		return NewFault(CodeInvalidParams, msg)
+	case strings.HasPrefix(msg, "rpc: can't find"),
+		strings.HasPrefix(msg, "rpc: service/method request ill-formed"):
+		return NewFault(CodeMethodNotFound, msg)
+	}
+	// net/rpc only hands us the message of the error.
+	return errors.New(msg)
+}
+
+// RPCHandler returns a Handler serving the services registered with
+// server, or rpc.DefaultServer if nil.
+func RPCHandler(server *rpc.Server) http.Handler {
+	if server == nil {
+		server = rpc.DefaultServer
+	}
+	return &Handler{Server: server}
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Register adds to the Methods of h the methods of rcvr which net/rpc
+// would serve, named "Type.Method" after the concrete type of rcvr. Unlike
+// the services of Server, they are called directly, so that the errors
+// they return keep their value: the code of a *Fault or of a FaultCoder
+// reaches the caller. Register must be called before h serves requests.
+func (h *Handler) Register(rcvr interface{}) error {
+	return h.RegisterName(reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name(), rcvr)
+}
+
+// RegisterName is like Register but uses name instead of the type of rcvr.
+func (h *Handler) RegisterName(name string, rcvr interface{}) error {
+	v := reflect.ValueOf(rcvr)
+	t := v.Type()
+	if name == "" {
+		return fmt.Errorf("xmlrpc: no service name for type %s", t)
+	}
+	methods := make(map[string]Method)
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		mt := m.Type
+		if m.PkgPath != "" || mt.NumIn() != 3 || mt.NumOut() != 1 || mt.Out(0) != errorType {
+			continue
+		}
+		argType, replyType := mt.In(1), mt.In(2)
+		if replyType.Kind() != reflect.Ptr || !exportedOrBuiltin(argType) || !exportedOrBuiltin(replyType) {
+			continue
+		}
+		methods[name+"."+m.Name] = rpcMethod(v.Method(i), argType, replyType.Elem())
+	}
+	if len(methods) == 0 {
+		return fmt.Errorf("xmlrpc: type %s has no exported methods of suitable type", t)
+	}
+	if h.Methods == nil {
+		h.Methods = make(map[string]Method)
+	}
+	for name, m := range methods {
+		h.Methods[name] = m
+	}
+	return nil
+}
+
+// exportedOrBuiltin reports whether t, or the type it points to, may be
+// used by a net/rpc method.
+func exportedOrBuiltin(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return token.IsExported(t.Name()) || t.PkgPath() == ""
+}
+
+// rpcMethod returns the Method calling m, a net/rpc method taking args of
+// argType and a reply pointing to replyType.
+func rpcMethod(m reflect.Value, argType, replyType reflect.Type) Method {
+	return func(r *http.Request, args Array) (interface{}, error) {
+		var argv reflect.Value
+		if argType.Kind() == reflect.Ptr {
+			argv = reflect.New(argType.Elem())
+		} else {
+			argv = reflect.New(argType)
+		}
+		if err := assignParams(argv.Interface(), args); err != nil {
+			return nil, NewFault(CodeInvalidParams, err.Error())
+		}
+		if argType.Kind() != reflect.Ptr {
+			argv = argv.Elem()
+		}
+		replyv := reflect.New(replyType)
+		if err := m.Call([]reflect.Value{argv, replyv})[0].Interface(); err != nil {
+			return nil, err.(error)
+		}
+		return replyv.Elem().Interface(), nil
+	}
+}
+
+// serveRPC calls method of the net/rpc server with args.
+func serveRPC(server *rpc.Server, method string, args Array) (interface{}, error) {
+	dc := &dispatchCodec{method: method, params: args}
+	server.ServeRequest(dc)
+	return dc.reply, dc.err
+}
+
+// dispatchCodec is a net/rpc ServerCodec serving a single decoded call
+// and keeping its result.
+type dispatchCodec struct {
+	method  string
+	params  Array
+	bodyErr error
+	reply   interface{}
+	err     error
+}
+
+func (dc *dispatchCodec) ReadRequestHeader(req *rpc.Request) error {
+	req.ServiceMethod = dc.method
+	req.Seq = 0
+	return nil
+}
+
+func (dc *dispatchCodec) ReadRequestBody(x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	dc.bodyErr = assignParams(x, dc.params)
+	return dc.bodyErr
+}
+
+func (dc *dispatchCodec) WriteResponse(resp *rpc.Response, reply interface{}) error {
+	if resp.Error != "" {
+		dc.err = rpcError(resp.Error, dc.bodyErr)
+		return nil
+	}
+	dc.reply = reflect.Indirect(reflect.ValueOf(reply)).Interface()
+	return nil
+}
+
+func (dc *dispatchCodec) Close() error {
+	return nil
+}
@@ -0,0 +1,283 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type ArithArgs struct {
+	A, B int
+}
+
+type ArithQuotient struct {
+	Quo, Rem int
+}
+
+type Arith int
+
+func (*Arith) Multiply(args *ArithArgs, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (*Arith) Divide(args ArithArgs, quo *ArithQuotient) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	quo.Quo = args.A / args.B
+	quo.Rem = args.A % args.B
+	return nil
+}
+
+func (*Arith) Sum(args []int, reply *int) error {
+	for _, a := range args {
+		*reply += a
+	}
+	return nil
+}
+
+func (*Arith) Sqrt(x float64, reply *float64) error {
+	if x < 0 {
+		return &Fault{Code: CodeInvalidParams, Message: "negative operand", Data: Struct{"operand": x}}
+	}
+	*reply = math.Sqrt(x)
+	return nil
+}
+
+func (*Arith) Factorial(n int, reply *int) error {
+	if n > 20 {
+		return fmt.Errorf("factorial: %w", codedError{})
+	}
+	*reply = 1
+	for i := 2; i <= n; i++ {
+		*reply *= i
+	}
+	return nil
+}
+
+type Broken int
+
+// Reply returns n long strings followed by a value which cannot be
+// encoded.
+func (*Broken) Reply(n int, reply *[]interface{}) error {
+	for i := 0; i < n; i++ {
+		*reply = append(*reply, strings.Repeat("x", 100))
+	}
+	*reply = append(*reply, make(chan int))
+	return nil
+}
+
+func newArithServer(t *testing.T) *httptest.Server {
+	server := rpc.NewServer()
+	if err := server.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(RPCHandler(server))
+}
+
+func TestServerCodec(t *testing.T) {
+	ts := newArithServer(t)
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	v, err := client.Call("Arith.Multiply", 6, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{42}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+
+	v, err = client.Call("Arith.Divide", Struct{"A": 17, "b": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{Struct{"Quo": 3, "Rem": 2}}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+
+	v, err = client.Call("Arith.Sum", []int{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{6}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+
+	tests := []struct {
+		method string
+		args   []interface{}
+		want   error
+	}{
+		{"Arith.Divide", []interface{}{1, 0}, ErrApplicationError},
+		{"Arith.Power", []interface{}{1, 2}, ErrMethodNotFound},
+		{"Nope.Multiply", []interface{}{1, 2}, ErrMethodNotFound},
+		{"Arith.Multiply", []interface{}{"1", 2}, ErrInvalidParams},
+		{"Arith.Multiply", []interface{}{1, 2, 3}, ErrInvalidParams},
+	}
+	for _, test := range tests {
+		if _, err := client.Call(test.method, test.args...); !errors.Is(err, test.want) {
+			t.Fatalf("%s%v: want %v but got %v", test.method, test.args, test.want, err)
+		}
+	}
+
+	resp, err := http.Post(ts.URL, "text/xml", strings.NewReader("<methodCall><methodName>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, _, err := Unmarshal(resp.Body); !errors.Is(err, ErrParseError) {
+		t.Fatalf("want %v but got %v", ErrParseError, err)
+	}
+}
+
+func TestServerEncodeError(t *testing.T) {
+	checkFault := func(name string, body []byte) {
+		if n := bytes.Count(body, []byte("<?xml")); n != 1 {
+			t.Fatalf("%s: want a single XML declaration but got %d", name, n)
+		}
+		if _, _, err := Unmarshal(bytes.NewReader(body)); !errors.Is(err, ErrApplicationError) {
+			t.Fatalf("%s: want %v but got %v", name, ErrApplicationError, err)
+		}
+	}
+
+	server := rpc.NewServer()
+	if err := server.Register(new(Broken)); err != nil {
+		t.Fatal(err)
+	}
+	var req, resp bytes.Buffer
+	if err := Marshal(&req, "Broken.Reply", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.ServeRequest(NewServerCodec(&req, &resp)); err != nil {
+		t.Fatal(err)
+	}
+	checkFault("ServerCodec", resp.Bytes())
+
+	h := &Handler{}
+	if err := h.Register(new(Broken)); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	req.Reset()
+	if err := Marshal(&req, "Broken.Reply", 1000); err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.Post(ts.URL, "text/xml", &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFault("Handler", body)
+}
+
+func TestHandlerRegister(t *testing.T) {
+	h := &Handler{}
+	if err := h.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Register(new(int)); err == nil {
+		t.Fatal("want error registering a type without methods")
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	v, err := client.Call("Arith.Multiply", 6, 7)
+	if err != nil || !reflect.DeepEqual(v, Array{42}) {
+		t.Fatalf("response different from expected (%v, %v)", v, err)
+	}
+	v, err = client.Call("Arith.Divide", 17, 5)
+	if err != nil || !reflect.DeepEqual(v, Array{Struct{"Quo": 3, "Rem": 2}}) {
+		t.Fatalf("response different from expected (%v, %v)", v, err)
+	}
+
+	_, err = client.Call("Arith.Sqrt", -4.0)
+	var f *Fault
+	if !errors.As(err, &f) || f.Code != CodeInvalidParams || f.Message != "negative operand" || f.Data["operand"] != -4.0 {
+		t.Fatalf("want the fault returned by the method but got %#v", err)
+	}
+	_, err = client.Call("Arith.Factorial", 30)
+	if !errors.As(err, &f) || f.Code != 429 || f.Message != "factorial: quota exceeded" {
+		t.Fatalf("want the code of the FaultCoder but got %v", err)
+	}
+
+	tests := []struct {
+		method string
+		args   []interface{}
+		want   error
+	}{
+		{"Arith.Divide", []interface{}{1, 0}, ErrApplicationError},
+		{"Arith.Power", []interface{}{1, 2}, ErrMethodNotFound},
+		{"Arith.Multiply", []interface{}{"1", 2}, ErrInvalidParams},
+		{"Arith.Multiply", []interface{}{1, 2, 3}, ErrInvalidParams},
+	}
+	for _, test := range tests {
+		if _, err := client.Call(test.method, test.args...); !errors.Is(err, test.want) {
+			t.Fatalf("%s%v: want %v but got %v", test.method, test.args, test.want, err)
+		}
+	}
+}
+
+func TestClientCodec(t *testing.T) {
+	ts := newArithServer(t)
+	defer ts.Close()
+
+	client := rpc.NewClientWithCodec(NewClientCodec(NewClient(ts.URL)))
+	defer client.Close()
+
+	var product int
+	if err := client.Call("Arith.Multiply", &ArithArgs{6, 7}, &product); err != nil {
+		t.Fatal(err)
+	}
+	if product != 42 {
+		t.Fatalf("want 42 but got %d", product)
+	}
+
+	var sum int
+	if err := client.Call("Arith.Sum", (*[]int)(nil), &sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 0 {
+		t.Fatalf("want 0 but got %d", sum)
+	}
+
+	calls := make([]*rpc.Call, 10)
+	for i := range calls {
+		calls[i] = client.Go("Arith.Divide", Array{100 + i, 7}, new(ArithQuotient), nil)
+	}
+	for i, call := range calls {
+		<-call.Done
+		if call.Error != nil {
+			t.Fatal(call.Error)
+		}
+		want := ArithQuotient{(100 + i) / 7, (100 + i) % 7}
+		if quo := *call.Reply.(*ArithQuotient); quo != want {
+			t.Fatalf("want %+v but got %+v", want, quo)
+		}
+	}
+
+	err := client.Call("Arith.Divide", ArithArgs{1, 0}, new(ArithQuotient))
+	if _, ok := err.(rpc.ServerError); !ok || !strings.Contains(err.Error(), "divide by zero") {
+		t.Fatalf("want ServerError but got %#v", err)
+	}
+
+	client.Close()
+	if err := client.Call("Arith.Multiply", &ArithArgs{1, 2}, &product); err != rpc.ErrShutdown {
+		t.Fatalf("want %v but got %v", rpc.ErrShutdown, err)
+	}
+}
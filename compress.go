@@ -0,0 +1,111 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptEncoding is the Accept-Encoding sent by clients.
+const acceptEncoding = "gzip, deflate"
+
+// compress returns body compressed with the HTTP content coding, gzip or
+// deflate. An empty coding returns body as is.
+func compress(coding string, body []byte) ([]byte, error) {
+	if coding == "" {
+		return body, nil
+	}
+	var buf bytes.Buffer
+	w, err := compressWriter(coding, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressWriter returns a writer compressing to w with the HTTP content
+// coding, to be closed once written.
+func compressWriter(coding string, w io.Writer) (io.WriteCloser, error) {
+	switch strings.ToLower(coding) {
+	case "", "identity":
+		return nopWriteCloser{w}, nil
+	case "gzip", "x-gzip":
+		return gzip.NewWriter(w), nil
+	case "deflate":
+		return zlib.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", coding)
+}
+
+// decompress returns a reader decoding r according to the HTTP content
+// coding, gzip or deflate.
+func decompress(coding string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(coding)) {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", coding)
+}
+
+// negotiateEncoding returns the content coding to use for a response given
+// the Accept-Encoding of the request: gzip or deflate if accepted, in that
+// order of preference, or empty.
+func negotiateEncoding(accept string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		accepted[coding] = q > 0
+	}
+	for _, coding := range []string{"gzip", "deflate"} {
+		if ok, listed := accepted[coding]; ok || (!listed && accepted["*"]) {
+			return coding
+		}
+	}
+	return ""
+}
+
+// compressResponse negotiates the content coding of the response to r and
+// returns the writer for the body, to be closed once written.
+func compressResponse(w http.ResponseWriter, r *http.Request) io.WriteCloser {
+	w.Header().Add("Vary", "Accept-Encoding")
+	switch negotiateEncoding(r.Header.Get("Accept-Encoding")) {
+	case "gzip":
+		w.Header().Set("Content-Encoding", "gzip")
+		return gzip.NewWriter(w)
+	case "deflate":
+		w.Header().Set("Content-Encoding", "deflate")
+		return zlib.NewWriter(w)
+	}
+	return nopWriteCloser{w}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
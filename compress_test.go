@@ -0,0 +1,71 @@
+package xmlrpc
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept, want string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip;q=0.5", "gzip"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"GZIP ; q=0.000, br", ""},
+		{"*", "gzip"},
+		{"gzip;q=0, *", "deflate"},
+	}
+	for _, test := range tests {
+		if got := negotiateEncoding(test.accept); got != test.want {
+			t.Fatalf("%q: want %q but got %q", test.accept, test.want, got)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	ts := newArithServer(t)
+	defer ts.Close()
+
+	for _, coding := range []string{"", "gzip", "deflate"} {
+		var reqEncoding, respEncoding string
+		client := NewClient(ts.URL)
+		client.ContentEncoding = coding
+		client.HTTPInterceptors = []HTTPInterceptor{
+			func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+				reqEncoding = req.Header.Get("Content-Encoding")
+				resp, err := next(req)
+				if resp != nil {
+					respEncoding = resp.Header.Get("Content-Encoding")
+				}
+				return resp, err
+			},
+		}
+		v, err := client.Call("Arith.Multiply", 6, 7)
+		if err != nil {
+			t.Fatalf("%q: %s", coding, err)
+		}
+		if !reflect.DeepEqual(v, Array{42}) {
+			t.Fatalf("%q: response different from expected (%+v)", coding, v)
+		}
+		if reqEncoding != coding || respEncoding != "gzip" {
+			t.Fatalf("%q: unexpected encodings %q and %q", coding, reqEncoding, respEncoding)
+		}
+	}
+
+	client := NewClient(ts.URL)
+	client.ContentEncoding = "br"
+	if _, err := client.Call("Arith.Multiply", 6, 7); err == nil {
+		t.Fatal("expected error for unsupported encoding")
+	}
+	client.ContentEncoding = ""
+	client.Header = http.Header{"Content-Encoding": {"br"}}
+	if _, err := client.Call("Arith.Multiply", 6, 7); err == nil {
+		t.Fatal("server should reject unsupported encoding")
+	} else if se, ok := err.(*StatusError); !ok || se.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("want StatusError but got %#v", err)
+	}
+}
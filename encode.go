@@ -0,0 +1,484 @@
+package xmlrpc
+
+import (
+	"encoding/base64"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// encodeState buffers the output of an encoding, which is flushed to w
+// whenever the buffer fills up, so that large values are still streamed.
+type encodeState struct {
+	opts *EncoderOptions
+	w    io.Writer
+	buf  []byte
+	// readBase64 is set once a Base64Reader is read.
+	readBase64 bool
+	// ptrLevel is the nesting depth of pointers, maps and slices, and
+	// ptrSeen holds those being encoded once it gets deep.
+	ptrLevel uint
+	ptrSeen  map[cycleKey]struct{}
+}
+
+// startDetectingCyclesAfter is the ptrLevel past which the values being
+// encoded are tracked, so that a value containing itself fails instead of
+// overflowing the stack.
+const startDetectingCyclesAfter = 1000
+
+// cycleKey identifies a pointer, map or slice being encoded.
+type cycleKey struct {
+	t   reflect.Type
+	ptr uintptr
+	len int
+}
+
+const (
+	flushSize   = 32 << 10
+	maxPoolSize = 1 << 20 // larger buffers are not kept in the pool
+)
+
+var encodeStatePool = sync.Pool{
+	New: func() interface{} {
+		return &encodeState{buf: make([]byte, 0, 4096)}
+	},
+}
+
+func newEncodeState(opts *EncoderOptions, w io.Writer) *encodeState {
+	e := encodeStatePool.Get().(*encodeState)
+	e.opts, e.w, e.buf, e.readBase64, e.ptrLevel = opts, w, e.buf[:0], false, 0
+	return e
+}
+
+func (e *encodeState) free() {
+	if cap(e.buf) > maxPoolSize {
+		return
+	}
+	e.opts, e.w = nil, nil
+	encodeStatePool.Put(e)
+}
+
+// Write appends p to the buffer, for use as the output of base64
+// encoders.
+func (e *encodeState) Write(p []byte) (int, error) {
+	e.buf = append(e.buf, p...)
+	if err := e.flushIfFull(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *encodeState) flushIfFull() error {
+	if len(e.buf) < flushSize {
+		return nil
+	}
+	return e.flush()
+}
+
+func (e *encodeState) flush() error {
+	_, err := e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
+}
+
+func (e *encodeState) str(s string) {
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encodeState) text(s string) {
+	e.buf = appendEscaped(e.buf, s)
+}
+
+// enter is called before encoding the elements of r, a pointer, map or
+// slice, and leave after it. Past startDetectingCyclesAfter levels, enter
+// fails with UnsupportedCycle if r is already being encoded.
+func (e *encodeState) enter(r reflect.Value) error {
+	if e.ptrLevel++; e.ptrLevel <= startDetectingCyclesAfter {
+		return nil
+	}
+	key := newCycleKey(r)
+	if _, ok := e.ptrSeen[key]; ok {
+		e.ptrLevel--
+		return UnsupportedCycle
+	}
+	if e.ptrSeen == nil {
+		e.ptrSeen = make(map[cycleKey]struct{})
+	}
+	e.ptrSeen[key] = struct{}{}
+	return nil
+}
+
+func (e *encodeState) leave(r reflect.Value) {
+	if e.ptrLevel > startDetectingCyclesAfter {
+		delete(e.ptrSeen, newCycleKey(r))
+	}
+	e.ptrLevel--
+}
+
+func newCycleKey(r reflect.Value) cycleKey {
+	key := cycleKey{t: r.Type(), ptr: r.Pointer()}
+	if r.Kind() == reflect.Slice {
+		key.len = r.Len()
+	}
+	return key
+}
+
+// encode writes the value r, walking interfaces and pointers.
+func (e *encodeState) encode(r reflect.Value, typ bool) error {
+	if !r.IsValid() {
+		e.str("<nil/>")
+		return nil
+	}
+	return typeEncoder(r.Type())(e, r, typ)
+}
+
+// encoderFunc writes values of a given type. Strings are written in a
+// string element if typ is true, and as untyped text otherwise.
+type encoderFunc func(e *encodeState, r reflect.Value, typ bool) error
+
+var encoderCache sync.Map // map[reflect.Type]encoderFunc
+
+// typeEncoder returns the cached encode plan of t, building it on first
+// use.
+func typeEncoder(t reflect.Type) encoderFunc {
+	if f, ok := encoderCache.Load(t); ok {
+		return f.(encoderFunc)
+	}
+
+	// Store a placeholder waiting for the plan, so that recursive types
+	// refer to it instead of building their plan forever.
+	var (
+		wg sync.WaitGroup
+		f  encoderFunc
+	)
+	wg.Add(1)
+	fi, loaded := encoderCache.LoadOrStore(t, encoderFunc(func(e *encodeState, r reflect.Value, typ bool) error {
+		wg.Wait()
+		return f(e, r, typ)
+	}))
+	if loaded {
+		return fi.(encoderFunc)
+	}
+	f = newTypeEncoder(t)
+	wg.Done()
+	encoderCache.Store(t, f)
+	return f
+}
+
+var base64ReaderType = reflect.TypeOf(Base64Reader{})
+
+func newTypeEncoder(t reflect.Type) encoderFunc {
+	switch t {
+	case base64ReaderType:
+		return encodeBase64Reader
+	case timeType:
+		return encodeTime
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return encodeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return encodeUint
+	case reflect.Float32, reflect.Float64:
+		bits := t.Bits()
+		return func(e *encodeState, r reflect.Value, typ bool) error {
+			return e.double(r.Float(), bits, typ)
+		}
+	case reflect.String:
+		return encodeString
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return encodeBytes
+		}
+		return newArrayEncoder(t)
+	case reflect.Array:
+		return newArrayEncoder(t)
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return encodeUnsupported
+		}
+		return newMapEncoder(t)
+	case reflect.Struct:
+		return newStructEncoder(t)
+	case reflect.Ptr:
+		return newPtrEncoder(t)
+	case reflect.Interface:
+		return encodeInterface
+	}
+	return encodeUnsupported
+}
+
+func encodeUnsupported(e *encodeState, r reflect.Value, typ bool) error {
+	return UnsupportedType
+}
+
+func encodeBool(e *encodeState, r reflect.Value, typ bool) error {
+	e.str("<boolean>")
+	e.buf = strconv.AppendBool(e.buf, r.Bool())
+	e.str("</boolean>")
+	return nil
+}
+
+func encodeInt(e *encodeState, r reflect.Value, typ bool) error {
+	e.str("<int>")
+	e.buf = strconv.AppendInt(e.buf, r.Int(), 10)
+	e.str("</int>")
+	return nil
+}
+
+func encodeUint(e *encodeState, r reflect.Value, typ bool) error {
+	e.str("<int>")
+	e.buf = strconv.AppendUint(e.buf, r.Uint(), 10)
+	e.str("</int>")
+	return nil
+}
+
+func (e *encodeState) double(f float64, bits int, typ bool) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		switch e.opts.NaNPolicy {
+		case NaNNil:
+			e.str("<nil/>")
+			return nil
+		case NaNString:
+			e.string(strconv.FormatFloat(f, 'g', -1, 64), typ)
+			return nil
+		}
+		return UnsupportedFloat
+	}
+	// The spec does not allow exponents, so always use decimal notation.
+	prec := -1
+	if e.opts.FloatPrecision > 0 {
+		prec = e.opts.FloatPrecision
+	}
+	e.str("<double>")
+	e.buf = strconv.AppendFloat(e.buf, f, 'f', prec, bits)
+	e.str("</double>")
+	return nil
+}
+
+func (e *encodeState) string(s string, typ bool) {
+	if !typ {
+		e.text(s)
+		return
+	}
+	e.str("<string>")
+	e.text(s)
+	e.str("</string>")
+}
+
+func encodeString(e *encodeState, r reflect.Value, typ bool) error {
+	e.string(r.String(), typ)
+	return nil
+}
+
+func encodeBytes(e *encodeState, r reflect.Value, typ bool) error {
+	b := r.Bytes()
+	e.str("<base64>")
+	n := len(e.buf)
+	size := base64.StdEncoding.EncodedLen(len(b))
+	if cap(e.buf)-n < size {
+		buf := make([]byte, n, 2*cap(e.buf)+size)
+		copy(buf, e.buf)
+		e.buf = buf
+	}
+	e.buf = e.buf[:n+size]
+	base64.StdEncoding.Encode(e.buf[n:], b)
+	e.str("</base64>")
+	return nil
+}
+
+func encodeBase64Reader(e *encodeState, r reflect.Value, typ bool) error {
+	e.str("<base64>")
+	e.readBase64 = true
+	enc := base64.NewEncoder(base64.StdEncoding, e)
+	if _, err := io.Copy(enc, r.Interface().(Base64Reader).Reader); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	e.str("</base64>")
+	return nil
+}
+
+// encodeTime writes a time.Time in the format of the spec, which has no
+// time zone, so the time is written as is in its location.
+func encodeTime(e *encodeState, r reflect.Value, typ bool) error {
+	e.str("<dateTime.iso8601>")
+	e.buf = r.Interface().(time.Time).AppendFormat(e.buf, "20060102T15:04:05")
+	e.str("</dateTime.iso8601>")
+	return nil
+}
+
+func newArrayEncoder(t reflect.Type) encoderFunc {
+	elem := typeEncoder(t.Elem())
+	slice := t.Kind() == reflect.Slice
+	return func(e *encodeState, r reflect.Value, typ bool) error {
+		if slice {
+			if err := e.enter(r); err != nil {
+				return err
+			}
+			defer e.leave(r)
+		}
+		e.str("<array><data>")
+		for i, n := 0, r.Len(); i < n; i++ {
+			e.str("<value>")
+			if err := elem(e, r.Index(i), typ); err != nil {
+				return err
+			}
+			e.str("</value>")
+			if err := e.flushIfFull(); err != nil {
+				return err
+			}
+		}
+		e.str("</data></array>")
+		return nil
+	}
+}
+
+func newMapEncoder(t reflect.Type) encoderFunc {
+	elem := typeEncoder(t.Elem())
+	return func(e *encodeState, r reflect.Value, typ bool) error {
+		if err := e.enter(r); err != nil {
+			return err
+		}
+		defer e.leave(r)
+		e.str("<struct>")
+		iter := r.MapRange()
+		for iter.Next() {
+			e.str("<member><name>")
+			e.text(iter.Key().String())
+			e.str("</name><value>")
+			if err := elem(e, iter.Value(), typ); err != nil {
+				return err
+			}
+			e.str("</value></member>")
+			if err := e.flushIfFull(); err != nil {
+				return err
+			}
+		}
+		e.str("</struct>")
+		return nil
+	}
+}
+
+// memberPlan writes a struct field as a member.
+type memberPlan struct {
+	index []int
+	open  string // <member><name>...</name><value>
+	enc   encoderFunc
+}
+
+func newStructEncoder(t reflect.Type) encoderFunc {
+	fields := cachedTypeFields(t)
+	members := make([]memberPlan, len(fields))
+	for i, f := range fields {
+		members[i] = memberPlan{
+			index: f.index,
+			open:  "<member><name>" + string(appendEscaped(nil, f.name)) + "</name><value>",
+			enc:   typeEncoder(t.FieldByIndex(f.index).Type),
+		}
+	}
+	return func(e *encodeState, r reflect.Value, typ bool) error {
+		e.str("<struct>")
+		for _, m := range members {
+			fv := fieldByIndex(r, m.index, false)
+			if !fv.IsValid() {
+				continue
+			}
+			e.str(m.open)
+			if err := m.enc(e, fv, typ); err != nil {
+				return err
+			}
+			e.str("</value></member>")
+			if err := e.flushIfFull(); err != nil {
+				return err
+			}
+		}
+		e.str("</struct>")
+		return nil
+	}
+}
+
+func newPtrEncoder(t reflect.Type) encoderFunc {
+	elem := typeEncoder(t.Elem())
+	return func(e *encodeState, r reflect.Value, typ bool) error {
+		if r.IsNil() {
+			e.str("<nil/>")
+			return nil
+		}
+		if err := e.enter(r); err != nil {
+			return err
+		}
+		defer e.leave(r)
+		return elem(e, r.Elem(), typ)
+	}
+}
+
+func encodeInterface(e *encodeState, r reflect.Value, typ bool) error {
+	if r.IsNil() {
+		e.str("<nil/>")
+		return nil
+	}
+	return e.encode(r.Elem(), typ)
+}
+
+// appendEscaped appends s to dst escaped as xml.EscapeText does.
+func appendEscaped(dst []byte, s string) []byte {
+	last := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c < utf8.RuneSelf && c != '"' && c != '\'' && c != '&' && c != '<' && c != '>' {
+			i++
+			continue
+		}
+		r, width := utf8.DecodeRuneInString(s[i:])
+		var esc string
+		switch r {
+		case '"':
+			esc = "&#34;"
+		case '\'':
+			esc = "&#39;"
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		case '\t':
+			esc = "&#x9;"
+		case '\n':
+			esc = "&#xA;"
+		case '\r':
+			esc = "&#xD;"
+		default:
+			if !isInCharacterRange(r) || r == utf8.RuneError && width == 1 {
+				esc = "\uFFFD"
+				break
+			}
+			i += width
+			continue
+		}
+		dst = append(dst, s[last:i]...)
+		dst = append(dst, esc...)
+		i += width
+		last = i
+	}
+	return append(dst, s[last:]...)
+}
+
+// isInCharacterRange reports whether r may appear in an XML document.
+func isInCharacterRange(r rune) bool {
+	return r == 0x09 ||
+		r == 0x0A ||
+		r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
@@ -0,0 +1,273 @@
+package xmlrpc
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// ScalarEvent is a value other than an array or a struct.
+	ScalarEvent EventKind = iota
+	// ArrayStartEvent starts an array, whose elements follow.
+	ArrayStartEvent
+	// ArrayEndEvent ends an array.
+	ArrayEndEvent
+	// StructStartEvent starts a struct, whose members follow.
+	StructStartEvent
+	// StructEndEvent ends a struct.
+	StructEndEvent
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case ScalarEvent:
+		return "scalar"
+	case ArrayStartEvent:
+		return "array start"
+	case ArrayEndEvent:
+		return "array end"
+	case StructStartEvent:
+		return "struct start"
+	case StructEndEvent:
+		return "struct end"
+	}
+	return "unknown"
+}
+
+// Path locates a value in the params: its first element is the index of
+// the param, followed by the index of each array element as an int and
+// the name of each struct member as a string.
+type Path []interface{}
+
+// String returns the path as in [0][12].name.
+func (p Path) String() string {
+	var b strings.Builder
+	for _, e := range p {
+		switch e := e.(type) {
+		case int:
+			b.WriteString("[" + strconv.Itoa(e) + "]")
+		case string:
+			b.WriteString("." + e)
+		}
+	}
+	return b.String()
+}
+
+// Event is a step of an EventReader.
+type Event struct {
+	Kind EventKind
+	// Path locates the value. It is only valid until the next event.
+	Path Path
+	// Value is the value of a ScalarEvent, typed as by Decode.
+	Value interface{}
+}
+
+// EventReader reads params as a sequence of events, so that huge
+// responses can be processed one value at a time instead of building the
+// whole Array.
+type EventReader struct {
+	p      *xml.Decoder
+	frames []eventFrame
+	values []valueState
+	path   Path
+	err    error
+}
+
+type eventFrame struct {
+	kind  EventKind // ArrayStartEvent or StructStartEvent, ScalarEvent for params
+	index int
+	name  string
+}
+
+type valueState struct {
+	typed bool
+	text  string
+}
+
+// Events reads the document up to its params and returns the method
+// name, empty for a response, and an EventReader over the params.
+func (dec *Decoder) Events() (string, *EventReader, error) {
+	p, name, e := dec.start(nil)
+	if e != nil {
+		return name, nil, e
+	}
+	se, e := nextStart(p)
+	if e != nil {
+		return name, nil, e
+	}
+	if se.Name.Local != "params" {
+		_, v, e := nextElmt(p, se) // a fault gives its error
+		if e == nil {
+			e = fmt.Errorf("wanted params, got %#v", v)
+		}
+		return name, nil, e
+	}
+	er := &EventReader{
+		p:      p,
+		frames: []eventFrame{{kind: ScalarEvent, index: -1}},
+	}
+	return name, er, nil
+}
+
+// Walk reads the document, calling fn for every event of its params, and
+// returns the method name, empty for a response. It stops at the first
+// error returned by fn.
+func (dec *Decoder) Walk(fn func(Event) error) (string, error) {
+	name, er, err := dec.Events()
+	if err != nil {
+		return name, err
+	}
+	for {
+		ev, err := er.Next()
+		if err == io.EOF {
+			return name, nil
+		}
+		if err != nil {
+			return name, err
+		}
+		if err := fn(ev); err != nil {
+			return name, err
+		}
+	}
+}
+
+// Next returns the next event, or io.EOF once the params are over.
+func (er *EventReader) Next() (Event, error) {
+	if er.err != nil {
+		return Event{}, er.err
+	}
+	ev, err := er.next()
+	if err != nil {
+		er.err = err
+	}
+	return ev, err
+}
+
+func (er *EventReader) event(kind EventKind, v interface{}) Event {
+	er.path = er.path[:0]
+	for _, f := range er.frames {
+		if f.kind == StructStartEvent {
+			er.path = append(er.path, f.name)
+		} else {
+			er.path = append(er.path, f.index)
+		}
+	}
+	return Event{Kind: kind, Path: er.path, Value: v}
+}
+
+// typed marks the value being read as typed, i.e. not a raw string.
+func (er *EventReader) typed() error {
+	if len(er.values) == 0 {
+		return errors.New("expected value")
+	}
+	er.values[len(er.values)-1].typed = true
+	return nil
+}
+
+func (er *EventReader) next() (Event, error) {
+	for {
+		t, e := er.p.Token()
+		if e == io.EOF {
+			e = io.ErrUnexpectedEOF
+		}
+		if e != nil {
+			return Event{}, e
+		}
+		top := &er.frames[len(er.frames)-1]
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "param":
+				top.index++
+			case "value":
+				if top.kind == ArrayStartEvent {
+					top.index++
+				}
+				er.values = append(er.values, valueState{})
+			case "data", "member":
+			case "name":
+				if err := er.p.DecodeElement(&top.name, &t); err != nil {
+					return Event{}, err
+				}
+			case "array", "struct":
+				if err := er.typed(); err != nil {
+					return Event{}, err
+				}
+				kind := ArrayStartEvent
+				if t.Name.Local == "struct" {
+					kind = StructStartEvent
+				}
+				ev := er.event(kind, nil)
+				er.frames = append(er.frames, eventFrame{kind: kind, index: -1})
+				return ev, nil
+			default:
+				if err := er.typed(); err != nil {
+					return Event{}, err
+				}
+				_, v, err := nextElmt(er.p, &t)
+				if err != nil {
+					return Event{}, err
+				}
+				return er.event(ScalarEvent, v), nil
+			}
+
+		case xml.CharData:
+			if n := len(er.values); n > 0 {
+				er.values[n-1].text += string(t)
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "value":
+				n := len(er.values) - 1
+				v := er.values[n]
+				er.values = er.values[:n]
+				if !v.typed {
+					return er.event(ScalarEvent, v.text), nil
+				}
+			case "array", "struct":
+				kind := ArrayEndEvent
+				if t.Name.Local == "struct" {
+					kind = StructEndEvent
+				}
+				er.frames = er.frames[:len(er.frames)-1]
+				return er.event(kind, nil), nil
+			case "params":
+				return Event{}, io.EOF
+			}
+		}
+	}
+}
+
+// CallWalk calls name with args like CallContext, calling fn for every
+// event of the params of the response as Decoder.Walk does, instead of
+// building them in memory. Interceptors see no params. An error returned
+// by fn ends the call without counting as a failure of the server. Since
+// events cannot be taken back, a call failing once fn was called is not
+// retried nor failed over.
+func (c *Client) CallWalk(ctx context.Context, fn func(Event) error, name string, args ...interface{}) error {
+	_, err := c.invoke(ctx, name, args, func(dec *Decoder) (Array, error) {
+		var called bool
+		_, err := dec.Walk(func(ev Event) error {
+			called = true
+			if err := fn(ev); err != nil {
+				return &callerError{err}
+			}
+			return nil
+		})
+		if err != nil && called && !isCallerError(err) {
+			err = &partialError{err}
+		}
+		return nil, err
+	})
+	return err
+}
@@ -0,0 +1,143 @@
+package xmlrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type recordedEvent struct {
+	Kind  EventKind
+	Path  string
+	Value interface{}
+}
+
+func TestEvents(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<methodCall><methodName>sum</methodName><params>
+<param><value><array><data>
+  <value><int>1</int></value>
+  <value>two</value>
+  <value><struct><member><name>x</name><value><double>3.5</double></value></member></struct></value>
+</data></array></value></param>
+<param><value><boolean>1</boolean></value></param>
+</params></methodCall>`
+
+	name, er, err := NewDecoder(strings.NewReader(doc)).Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "sum" {
+		t.Fatalf("unexpected method name %q", name)
+	}
+	var got []recordedEvent
+	for {
+		ev, err := er.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, recordedEvent{ev.Kind, ev.Path.String(), ev.Value})
+	}
+	want := []recordedEvent{
+		{ArrayStartEvent, "[0]", nil},
+		{ScalarEvent, "[0][0]", 1},
+		{ScalarEvent, "[0][1]", "two"},
+		{StructStartEvent, "[0][2]", nil},
+		{ScalarEvent, "[0][2].x", 3.5},
+		{StructEndEvent, "[0][2]", nil},
+		{ArrayEndEvent, "[0]", nil},
+		{ScalarEvent, "[1]", true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events different from expected\n got %+v\nwant %+v", got, want)
+	}
+	if _, err := er.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the params, got %v", err)
+	}
+}
+
+func TestEventsFault(t *testing.T) {
+	var b strings.Builder
+	if err := MarshalFault(&b, NewFault(4, "Too many parameters.")); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := NewDecoder(strings.NewReader(b.String())).Events()
+	var f *Fault
+	if !errors.As(err, &f) || f.Code != 4 {
+		t.Fatalf("expected fault 4, got %v", err)
+	}
+}
+
+func TestCallWalk(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Marshal(w, "", Array{1, 2, 3})
+	}))
+	defer ts.Close()
+
+	stop := errors.New("stop")
+	client := NewClient(ts.URL)
+	client.Breaker = &CircuitBreaker{FailureThreshold: 1}
+	for i := 0; i < 2; i++ {
+		sum := 0
+		err := client.CallWalk(context.Background(), func(ev Event) error {
+			if ev.Kind == ScalarEvent {
+				sum += ev.Value.(int)
+				if sum >= 3 {
+					return stop
+				}
+			}
+			return nil
+		}, "numbers")
+		if err != stop {
+			t.Fatalf("expected the error of the visitor, got %v", err)
+		}
+		if sum != 3 {
+			t.Fatalf("walk did not stop at the error (sum %d)", sum)
+		}
+	}
+	if state := client.Breaker.State(); state != BreakerClosed {
+		t.Fatalf("errors of the visitor should not open the circuit (%v)", state)
+	}
+}
+
+func TestCallWalkPartial(t *testing.T) {
+	var calls int32
+	truncated := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Length", "1000000")
+		io.WriteString(w, `<?xml version="1.0"?><methodResponse><params><param><value><array><data>`+
+			`<value><int>1</int></value><value><int>2</int></value>`)
+	})
+	a := httptest.NewServer(truncated)
+	defer a.Close()
+	b := httptest.NewServer(truncated)
+	defer b.Close()
+
+	client := NewMultiClient(a.URL, b.URL)
+	client.Retry = &RetryPolicy{MaxAttempts: 3, AllMethods: true, Retryable: func(error) bool { return true }}
+	var values []interface{}
+	err := client.CallWalk(context.Background(), func(ev Event) error {
+		if ev.Kind == ScalarEvent {
+			values = append(values, ev.Value)
+		}
+		return nil
+	}, "numbers")
+	if err == nil || isPartialError(err) {
+		t.Fatalf("want the error of the truncated response but got %#v", err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{1, 2}) {
+		t.Fatalf("want the events delivered once but got %v", values)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("calls which delivered events should not be retried (%d calls)", n)
+	}
+}
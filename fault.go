@@ -0,0 +1,170 @@
+package xmlrpc
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Fault codes of the specification for fault code interoperability.
+const (
+	CodeParseError          = -32700 // parse error, not well formed
+	CodeUnsupportedEncoding = -32701 // parse error, unsupported encoding
+	CodeInvalidCharacter    = -32702 // parse error, invalid character for encoding
+	CodeInvalidRequest      = -32600 // server error, invalid xml-rpc
+	CodeMethodNotFound      = -32601 // server error, requested method not found
+	CodeInvalidParams       = -32602 // server error, invalid method parameters
+	CodeInternalError       = -32603 // server error, internal xml-rpc error
+	CodeApplicationError    = -32500 // application error
+	CodeSystemError         = -32400 // system error
+	CodeTransportError      = -32300 // transport error
+)
+
+// Sentinel faults matching the standard fault codes with errors.Is.
+var (
+	ErrParseError          = &Fault{Code: CodeParseError, Message: "parse error. not well formed"}
+	ErrUnsupportedEncoding = &Fault{Code: CodeUnsupportedEncoding, Message: "parse error. unsupported encoding"}
+	ErrInvalidCharacter    = &Fault{Code: CodeInvalidCharacter, Message: "parse error. invalid character for encoding"}
+	ErrInvalidRequest      = &Fault{Code: CodeInvalidRequest, Message: "server error. invalid xml-rpc. not conforming to spec"}
+	ErrMethodNotFound      = &Fault{Code: CodeMethodNotFound, Message: "server error. requested method not found"}
+	ErrInvalidParams       = &Fault{Code: CodeInvalidParams, Message: "server error. invalid method parameters"}
+	ErrInternalError       = &Fault{Code: CodeInternalError, Message: "server error. internal xml-rpc error"}
+	ErrApplicationError    = &Fault{Code: CodeApplicationError, Message: "application error"}
+	ErrSystemError         = &Fault{Code: CodeSystemError, Message: "system error"}
+	ErrTransportError      = &Fault{Code: CodeTransportError, Message: "transport error"}
+)
+
+// Fault is the error returned for a fault response.
+type Fault struct {
+	Code    int
+	Message string
+	// Data holds the whole fault struct when decoding, including members
+	// other than faultCode and faultString such as a traceback. When
+	// encoding, its members other than those two are sent along.
+	Data Struct
+}
+
+// NewFault returns a fault with code and message.
+func NewFault(code int, message string) *Fault {
+	return &Fault{Code: code, Message: message}
+}
+
+func (f *Fault) Error() string { return fmt.Sprintf("%d: %s", f.Code, f.Message) }
+
+// Is reports whether target is a fault with the same code, so that
+// errors.Is(err, ErrMethodNotFound) matches any method not found fault
+// whatever its message.
+func (f *Fault) Is(target error) bool {
+	t, ok := target.(*Fault)
+	return ok && t.Code == f.Code
+}
+
+// FaultCoder is implemented by errors which carry their own fault code.
+type FaultCoder interface {
+	FaultCode() int
+}
+
+// FaultMapper converts the errors returned by method implementations into
+// the faults sent back to callers.
+type FaultMapper struct {
+	// DefaultCode is the code of faults for errors which do not provide
+	// one. Zero means CodeApplicationError.
+	DefaultCode int
+	// HideMessages replaces the message of faults for errors which do not
+	// provide a code by HiddenMessage, so that internal details are not
+	// leaked to callers.
+	HideMessages bool
+	// HiddenMessage is the message used when HideMessages is set. Empty
+	// means "internal error".
+	HiddenMessage string
+}
+
+// DefaultFaultMapper is the FaultMapper used by ToFault, MarshalFault and
+// Handlers without one of their own.
+var DefaultFaultMapper = &FaultMapper{}
+
+// Fault converts err into a fault. A *Fault found in the chain of err is
+// returned as is, and an error in the chain implementing FaultCoder gives
+// its code and the message of err. Other errors get DefaultCode.
+func (m *FaultMapper) Fault(err error) *Fault {
+	if err == nil {
+		return nil
+	}
+	var f *Fault
+	if errors.As(err, &f) {
+		return f
+	}
+	var fc FaultCoder
+	if errors.As(err, &fc) {
+		return &Fault{Code: fc.FaultCode(), Message: err.Error()}
+	}
+	f = &Fault{Code: m.DefaultCode, Message: err.Error()}
+	if f.Code == 0 {
+		f.Code = CodeApplicationError
+	}
+	if m.HideMessages {
+		f.Message = m.HiddenMessage
+		if f.Message == "" {
+			f.Message = "internal error"
+		}
+	}
+	return f
+}
+
+// ToFault converts err into a fault using DefaultFaultMapper.
+func ToFault(err error) *Fault {
+	return DefaultFaultMapper.Fault(err)
+}
+
+// ErrNilFault is returned when encoding a nil fault, such as the one
+// ToFault returns for a nil error.
+var ErrNilFault = errors.New("nil fault")
+
+// EncodeFault writes a methodResponse carrying fault f.
+func (enc *Encoder) EncodeFault(f *Fault) error {
+	if f == nil {
+		return ErrNilFault
+	}
+	w, err := enc.prolog()
+	if err != nil {
+		return err
+	}
+	io.WriteString(w, "<methodResponse><fault><value><struct>")
+	io.WriteString(w, "<member><name>faultCode</name><value><int>")
+	io.WriteString(w, strconv.Itoa(f.Code))
+	io.WriteString(w, "</int></value></member>")
+	io.WriteString(w, "<member><name>faultString</name><value>")
+	if err := enc.writeXML(w, f.Message, !enc.UntypedStrings); err != nil {
+		return err
+	}
+	io.WriteString(w, "</value></member>")
+	names := make([]string, 0, len(f.Data))
+	for name := range f.Data {
+		if name != "faultCode" && name != "faultString" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		io.WriteString(w, "<member><name>")
+		if err := xml.EscapeText(w, []byte(name)); err != nil {
+			return err
+		}
+		io.WriteString(w, "</name><value>")
+		if err := enc.writeXML(w, f.Data[name], !enc.UntypedStrings); err != nil {
+			return err
+		}
+		io.WriteString(w, "</value></member>")
+	}
+	_, err = io.WriteString(w, "</struct></value></fault></methodResponse>")
+	return err
+}
+
+// MarshalFault writes a methodResponse carrying err, converted into a
+// fault by ToFault, to w.
+func MarshalFault(w io.Writer, err error) error {
+	return NewEncoder(w).EncodeFault(ToFault(err))
+}
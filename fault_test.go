@@ -0,0 +1,154 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFaultIs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>-32601</int></value></member>
+<member><name>faultString</name><value>no such method: foo</value></member>
+</struct></value></fault></methodResponse>`))
+	}))
+	defer ts.Close()
+
+	_, err := NewClient(ts.URL).Call("foo")
+	if !errors.Is(err, ErrMethodNotFound) {
+		t.Fatalf("want %v but got %v", ErrMethodNotFound, err)
+	}
+	if errors.Is(err, ErrInvalidParams) {
+		t.Fatalf("%v should not match %v", err, ErrInvalidParams)
+	}
+	if wrapped := fmt.Errorf("calling foo: %w", err); !errors.Is(wrapped, ErrMethodNotFound) {
+		t.Fatalf("wrapped %v should match %v", wrapped, ErrMethodNotFound)
+	}
+	if errors.Is(err, errors.New(ErrMethodNotFound.Error())) {
+		t.Fatal("fault should only match faults")
+	}
+	if !errors.Is(NewFault(CodeInternalError, "boom"), ErrInternalError) {
+		t.Fatal("NewFault should match sentinel with the same code")
+	}
+}
+
+type codedError struct{}
+
+func (codedError) Error() string  { return "quota exceeded" }
+func (codedError) FaultCode() int { return 429 }
+
+func TestToFault(t *testing.T) {
+	tests := []struct {
+		mapper *FaultMapper
+		err    error
+		want   Fault
+	}{
+		{&FaultMapper{}, errors.New("disk full"), Fault{Code: CodeApplicationError, Message: "disk full"}},
+		{&FaultMapper{DefaultCode: CodeInternalError}, errors.New("disk full"), Fault{Code: CodeInternalError, Message: "disk full"}},
+		{&FaultMapper{HideMessages: true}, errors.New("disk full"), Fault{Code: CodeApplicationError, Message: "internal error"}},
+		{&FaultMapper{HideMessages: true, HiddenMessage: "oops"}, errors.New("disk full"), Fault{Code: CodeApplicationError, Message: "oops"}},
+		{&FaultMapper{HideMessages: true}, fmt.Errorf("get: %w", codedError{}), Fault{Code: 429, Message: "get: quota exceeded"}},
+		{&FaultMapper{HideMessages: true}, fmt.Errorf("get: %w", NewFault(4, "too many params")), Fault{Code: 4, Message: "too many params"}},
+	}
+	for _, test := range tests {
+		if f := test.mapper.Fault(test.err); f.Code != test.want.Code || f.Message != test.want.Message {
+			t.Fatalf("%v: want %+v but got %+v", test.err, test.want, *f)
+		}
+	}
+	if f := ToFault(nil); f != nil {
+		t.Fatalf("want nil but got %+v", f)
+	}
+}
+
+func TestMarshalFault(t *testing.T) {
+	var buf bytes.Buffer
+	if err := MarshalFault(&buf, fmt.Errorf("get: %w", codedError{})); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0"?><methodResponse><fault><value><struct>` +
+		`<member><name>faultCode</name><value><int>429</int></value></member>` +
+		`<member><name>faultString</name><value><string>get: quota exceeded</string></value></member>` +
+		`</struct></value></fault></methodResponse>`
+	if buf.String() != want {
+		t.Fatalf("want %q but got %q", want, buf.String())
+	}
+
+	_, _, err := Unmarshal(&buf)
+	var f *Fault
+	if !errors.As(err, &f) || f.Code != 429 || f.Message != "get: quota exceeded" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	buf.Reset()
+	if err := MarshalFault(&buf, nil); err != ErrNilFault {
+		t.Fatalf("want %v but got %v", ErrNilFault, err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("nothing should be written for a nil fault (%q)", buf.String())
+	}
+}
+
+func TestFaultData(t *testing.T) {
+	payload := `<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><string> 2 </string></value></member>
+<member><name>faultString</name><value>access denied</value></member>
+<member><name>faultData</name><value><struct>
+  <member><name>debug</name><value>Traceback (most recent call last)</value></member>
+</struct></value></member>
+</struct></value></fault></methodResponse>`
+
+	_, _, err := Unmarshal(strings.NewReader(payload))
+	var f *Fault
+	if !errors.As(err, &f) {
+		t.Fatalf("want Fault but got %v", err)
+	}
+	if f.Code != 2 || f.Message != "access denied" {
+		t.Fatalf("unexpected fault %+v", f)
+	}
+	want := Struct{"debug": "Traceback (most recent call last)"}
+	if !reflect.DeepEqual(f.Data["faultData"], want) {
+		t.Fatalf("unexpected fault data %+v", f.Data)
+	}
+
+	payload = `<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><i4>-32601</i4></value></member>
+<member><name>faultString</name><value>no such method</value></member>
+</struct></value></fault></methodResponse>`
+	if _, _, err = Unmarshal(strings.NewReader(payload)); !errors.Is(err, ErrMethodNotFound) {
+		t.Fatalf("want %v but got %v", ErrMethodNotFound, err)
+	}
+}
+
+func TestEncodeFaultData(t *testing.T) {
+	var buf bytes.Buffer
+	f := &Fault{Code: 1, Message: "failed", Data: Struct{
+		"faultCode":   99,
+		"traceback":   "line 1",
+		"faultData":   Array{1, 2},
+		"faultString": "ignored",
+	}}
+	if err := NewEncoder(&buf).EncodeFault(f); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0"?><methodResponse><fault><value><struct>` +
+		`<member><name>faultCode</name><value><int>1</int></value></member>` +
+		`<member><name>faultString</name><value><string>failed</string></value></member>` +
+		`<member><name>faultData</name><value><array><data><value><int>1</int></value><value><int>2</int></value></data></array></value></member>` +
+		`<member><name>traceback</name><value><string>line 1</string></value></member>` +
+		`</struct></value></fault></methodResponse>`
+	if buf.String() != want {
+		t.Fatalf("want %q but got %q", want, buf.String())
+	}
+
+	_, _, err := Unmarshal(&buf)
+	var got *Fault
+	if !errors.As(err, &got) || got.Code != 1 || got.Data["traceback"] != "line 1" {
+		t.Fatalf("unexpected error %#v", err)
+	}
+}
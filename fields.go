@@ -0,0 +1,132 @@
+package xmlrpc
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// field is a struct field encoded as a member.
+type field struct {
+	name   string
+	index  []int
+	tagged bool // name comes from the tag
+}
+
+// typeFields returns the members of struct type t in field order. As in
+// encoding/json, the exported fields of anonymous struct fields are
+// promoted unless the field is given a name by its tag, and a name
+// appearing more than once is given to the least nested field, or to the
+// tagged one at the same depth, or dropped if still ambiguous.
+//
+// The member name of a field is set by its xmlrpc tag, as in
+// `xmlrpc:"name"`. A field tagged "-" is ignored, and the inline option,
+// as in `xmlrpc:",inline"`, promotes the fields of a named struct field.
+func typeFields(t reflect.Type) []field {
+	var fields []field
+	collectFields(t, nil, &fields, map[reflect.Type]bool{})
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		a, b := fields[i], fields[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if len(a.index) != len(b.index) {
+			return len(a.index) < len(b.index)
+		}
+		return a.tagged && !b.tagged
+	})
+	out := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j == i+1 || len(fields[i+1].index) > len(fields[i].index) ||
+			fields[i].tagged != fields[i+1].tagged {
+			out = append(out, fields[i])
+		}
+		i = j
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].index, out[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return out
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// cachedTypeFields is like typeFields but computes the fields of each
+// type only once.
+func cachedTypeFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.([]field)
+}
+
+func collectFields(t reflect.Type, index []int, fields *[]field, visiting map[reflect.Type]bool) {
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("xmlrpc")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if n := strings.Index(tag, ","); n >= 0 {
+			name, opts = tag[:n], tag[n+1:]
+		}
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		idx := append(index[:len(index):len(index)], i)
+
+		inline := opts == "inline" || sf.Anonymous && name == ""
+		if inline && ft.Kind() == reflect.Struct && ft != timeType {
+			collectFields(ft, idx, fields, visiting)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		f := field{name: name, index: idx, tagged: name != ""}
+		if name == "" {
+			f.name = sf.Name
+		}
+		*fields = append(*fields, f)
+	}
+}
+
+// fieldByIndex returns the field of struct v at index, walking through
+// embedded pointers. A nil pointer gives the invalid Value, unless alloc
+// is true and it can be set to a new struct.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, n := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(n)
+	}
+	return v
+}
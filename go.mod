@@ -1 +1,3 @@
 module github.com/raphaelcoeffic/go-xmlrpc
+
+go 1.13
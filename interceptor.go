@@ -0,0 +1,45 @@
+package xmlrpc
+
+import (
+	"context"
+	"net/http"
+)
+
+// Invoker performs a call of method with args.
+type Invoker func(ctx context.Context, method string, args []interface{}) (Array, error)
+
+// Interceptor wraps the calls made by a Client, e.g. for logging, metrics
+// or refreshing credentials. It may change the method, args and results,
+// and proceeds with the call by invoking next, possibly several times.
+type Interceptor func(ctx context.Context, method string, args []interface{}, next Invoker) (Array, error)
+
+// RoundTripFunc sends an HTTP request and returns its response.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// HTTPInterceptor wraps the HTTP exchanges of a Client, proceeding by
+// invoking next. The raw request body can be read through req.GetBody
+// without consuming it, which encodes a streamed request again; a
+// response body which is read must be replaced.
+type HTTPInterceptor func(req *http.Request, next RoundTripFunc) (*http.Response, error)
+
+// chain returns f wrapped by interceptors, the first one outermost.
+func chain(interceptors []Interceptor, f Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], f
+		f = func(ctx context.Context, method string, args []interface{}) (Array, error) {
+			return interceptor(ctx, method, args, next)
+		}
+	}
+	return f
+}
+
+// chainHTTP returns f wrapped by interceptors, the first one outermost.
+func chainHTTP(interceptors []HTTPInterceptor, f RoundTripFunc) RoundTripFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], f
+		f = func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, next)
+		}
+	}
+	return f
+}
@@ -0,0 +1,91 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, args, err := Unmarshal(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		Marshal(w, "", append(Array{name}, args...)...)
+	}))
+	defer ts.Close()
+
+	var trace []string
+	client := NewClient(ts.URL)
+	client.Interceptors = []Interceptor{
+		func(ctx context.Context, method string, args []interface{}, next Invoker) (Array, error) {
+			trace = append(trace, "outer "+method)
+			v, err := next(ctx, method, args)
+			return append(v, "outer"), err
+		},
+		func(ctx context.Context, method string, args []interface{}, next Invoker) (Array, error) {
+			trace = append(trace, "inner "+method)
+			return next(ctx, "renamed", append(args, "redacted"))
+		},
+	}
+	v, err := client.Call("echo", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{"renamed", 1, "redacted", "outer"}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+	if !reflect.DeepEqual(trace, []string{"outer echo", "inner echo"}) {
+		t.Fatalf("unexpected interceptor order %v", trace)
+	}
+}
+
+func TestHTTPInterceptors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Marshal(w, "", "hello")
+	}))
+	defer ts.Close()
+
+	var reqBody, respBody string
+	client := NewClient(ts.URL)
+	client.HTTPInterceptors = []HTTPInterceptor{
+		func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			b, _ := ioutil.ReadAll(body)
+			reqBody = string(b)
+
+			resp, err := next(req)
+			if err != nil {
+				return nil, err
+			}
+			b, _ = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			respBody = string(b)
+			resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+			return resp, nil
+		},
+	}
+	v, err := client.Call("greet", "world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{"hello"}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+	if !strings.Contains(reqBody, "<methodName>greet</methodName>") {
+		t.Fatalf("unexpected request body %q", reqBody)
+	}
+	if !strings.Contains(respBody, "<string>hello</string>") {
+		t.Fatalf("unexpected response body %q", respBody)
+	}
+}
@@ -0,0 +1,80 @@
+package xmlrpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrQueueFull is returned by calls rejected by a ConcurrencyLimit whose
+// queue is full.
+var ErrQueueFull = errors.New("too many queued calls")
+
+// ConcurrencyLimit bounds the number of calls a Client has in flight.
+// Calls over the limit wait in a bounded queue until a call completes or
+// their context is done.
+type ConcurrencyLimit struct {
+	sem      chan struct{}
+	maxQueue int
+	queued   int64
+	rejected int64
+}
+
+// NewConcurrencyLimit returns a limit of maxInFlight concurrent calls with
+// up to maxQueue calls waiting. A maxInFlight below 1 means 1. If maxQueue
+// is zero calls never wait, and if it is negative the queue is unbounded.
+func NewConcurrencyLimit(maxInFlight, maxQueue int) *ConcurrencyLimit {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	return &ConcurrencyLimit{
+		sem:      make(chan struct{}, maxInFlight),
+		maxQueue: maxQueue,
+	}
+}
+
+// InFlight returns the number of calls in flight.
+func (l *ConcurrencyLimit) InFlight() int {
+	return len(l.sem)
+}
+
+// Queued returns the number of calls waiting in the queue.
+func (l *ConcurrencyLimit) Queued() int {
+	return int(atomic.LoadInt64(&l.queued))
+}
+
+// Rejected returns the number of calls rejected with ErrQueueFull so far.
+func (l *ConcurrencyLimit) Rejected() int {
+	return int(atomic.LoadInt64(&l.rejected))
+}
+
+// acquire waits for a slot, to be released by release. A nil limit never
+// waits.
+func (l *ConcurrencyLimit) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	if n := atomic.AddInt64(&l.queued, 1); l.maxQueue >= 0 && n > int64(l.maxQueue) {
+		atomic.AddInt64(&l.queued, -1)
+		atomic.AddInt64(&l.rejected, 1)
+		return ErrQueueFull
+	}
+	defer atomic.AddInt64(&l.queued, -1)
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *ConcurrencyLimit) release() {
+	if l != nil {
+		<-l.sem
+	}
+}
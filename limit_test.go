@@ -0,0 +1,86 @@
+package xmlrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	for i := 0; !cond(); i++ {
+		if i == 500 {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		Marshal(w, "", true)
+	}))
+	defer ts.Close()
+
+	limit := NewConcurrencyLimit(2, 1)
+	client := NewClient(ts.URL)
+	client.Concurrency = limit
+
+	calls := []*PendingCall{client.Go("a"), client.Go("b")}
+	waitFor(t, "2 calls in flight", func() bool { return limit.InFlight() == 2 })
+	calls = append(calls, client.Go("c"))
+	waitFor(t, "1 queued call", func() bool { return limit.Queued() == 1 })
+
+	if _, err := client.Call("d"); err != ErrQueueFull {
+		t.Fatalf("want %v but got %v", ErrQueueFull, err)
+	}
+	if limit.Rejected() != 1 {
+		t.Fatalf("want 1 rejected call but got %d", limit.Rejected())
+	}
+
+	close(release)
+	for _, pc := range calls {
+		<-pc.Done
+		if pc.Error != nil {
+			t.Fatal(pc.Error)
+		}
+	}
+	if limit.InFlight() != 0 || limit.Queued() != 0 {
+		t.Fatalf("want no calls left but got %d in flight, %d queued", limit.InFlight(), limit.Queued())
+	}
+}
+
+func TestConcurrencyLimitContext(t *testing.T) {
+	limit := NewConcurrencyLimit(1, -1)
+	if err := limit.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limit.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("want %v but got %v", context.DeadlineExceeded, err)
+	}
+	if limit.Queued() != 0 {
+		t.Fatalf("want empty queue but got %d", limit.Queued())
+	}
+	limit.release()
+	if err := limit.acquire(ctx); err != nil {
+		t.Fatalf("want slot but got %v", err)
+	}
+}
+
+func TestConcurrencyLimitZero(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Marshal(w, "", true)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	client.Concurrency = NewConcurrencyLimit(0, 0)
+	if _, err := client.Call("a"); err != nil {
+		t.Fatalf("a limit of 0 should allow 1 call in flight: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package xmlrpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit delays the calls of a Client to keep them within a number of
+// calls per second, globally and per method, using token buckets. Each
+// HTTP request counts, including retries and failovers to other endpoints.
+type RateLimit struct {
+	global *tokenBucket
+
+	mu      sync.RWMutex
+	methods map[string]*tokenBucket
+}
+
+// NewRateLimit returns a limit of rate calls per second for all methods,
+// allowing bursts of up to burst calls. A rate of zero or less means no
+// global limit.
+func NewRateLimit(rate float64, burst int) *RateLimit {
+	l := &RateLimit{methods: make(map[string]*tokenBucket)}
+	if rate > 0 {
+		l.global = newTokenBucket(rate, burst)
+	}
+	return l
+}
+
+// SetMethod limits the calls of method to rate calls per second, allowing
+// bursts of up to burst calls, on top of the global limit. A rate of zero
+// or less removes the limit of method.
+func (l *RateLimit) SetMethod(method string, rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rate > 0 {
+		l.methods[method] = newTokenBucket(rate, burst)
+	} else {
+		delete(l.methods, method)
+	}
+}
+
+// wait blocks until a call of method is allowed or ctx is done. A nil
+// limit never waits.
+func (l *RateLimit) wait(ctx context.Context, method string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.RLock()
+	buckets := []*tokenBucket{l.global, l.methods[method]}
+	l.mu.RUnlock()
+
+	now := time.Now()
+	var delay time.Duration
+	for _, b := range buckets {
+		if b == nil {
+			continue
+		}
+		if d := b.reserve(now); d > delay {
+			delay = d
+		}
+	}
+	if delay == 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		for _, b := range buckets {
+			if b != nil {
+				b.cancel()
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel gives back a token taken by reserve but not used.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
@@ -0,0 +1,55 @@
+package xmlrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	now := b.last
+	for i, want := range []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if d := b.reserve(now); d != want {
+			t.Fatalf("reservation %d: want %v but got %v", i, want, d)
+		}
+	}
+	b.cancel()
+	now = now.Add(time.Second)
+	if d := b.reserve(now); d != 0 {
+		t.Fatalf("want no delay after refill but got %v", d)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Marshal(w, "", true)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	client.RateLimit = NewRateLimit(0, 0)
+	client.RateLimit.SetMethod("slow", 20, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := client.Call("slow"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatalf("limited method was only delayed %v", d)
+	}
+
+	client.RateLimit = NewRateLimit(0.1, 1)
+	if _, err := client.Call("fast"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.CallContext(ctx, "fast"); err != context.DeadlineExceeded {
+		t.Fatalf("want %v but got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,154 @@
+package xmlrpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy configures how a Client retries failed calls. Network
+// errors, the HTTP statuses in StatusCodes and the faults in FaultCodes
+// are retried, with an exponential backoff between attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a call, including
+	// the first one and the requests failing over to another endpoint of
+	// a Balancer. Values below 2 disable retries.
+	MaxAttempts int
+	// Methods lists the methods which are safe to retry. Methods which are
+	// not idempotent should be left out so that they are never replayed:
+	// calls to the methods which are not listed are only retried when
+	// their request could not be sent, as when the connection is refused.
+	Methods []string
+	// AllMethods retries every method as if it were listed in Methods,
+	// including after errors occurring once the server may have served
+	// the call, so it is only safe if every method called is idempotent.
+	AllMethods bool
+	// StatusCodes lists the HTTP statuses which are retried. If nil, 502,
+	// 503 and 504 are retried.
+	StatusCodes []int
+	// FaultCodes lists the fault codes which are retried.
+	FaultCodes []int
+	// Retryable, if non-nil, replaces the classification above and
+	// reports whether a call failing with err should be retried. Errors
+	// of the reply of CallInto or the visitor of CallWalk are never
+	// retried, nor those occurring once CallInto wrote to an io.Writer or
+	// CallWalk called its visitor.
+	Retryable func(err error) bool
+
+	// Backoff is the delay before the first retry, doubled for every
+	// following one. Zero means 100ms.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between attempts. Zero means 10s.
+	MaxBackoff time.Duration
+	// Jitter is the fraction, between 0 and 1, of each delay which is
+	// randomized so that clients do not retry in lockstep.
+	Jitter float64
+}
+
+var defaultRetryStatusCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// allows reports whether calls to method may be replayed once sent.
+func (p *RetryPolicy) allows(method string) bool {
+	if p.AllMethods {
+		return true
+	}
+	for _, m := range p.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if isCallerError(err) || isPartialError(err) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	var (
+		netErr    net.Error
+		statusErr *StatusError
+		fault     *Fault
+	)
+	switch {
+	case errors.As(err, &statusErr):
+		codes := p.StatusCodes
+		if codes == nil {
+			codes = defaultRetryStatusCodes
+		}
+		for _, code := range codes {
+			if code == statusErr.Code {
+				return true
+			}
+		}
+	case errors.As(err, &fault):
+		for _, code := range p.FaultCodes {
+			if code == fault.Code {
+				return true
+			}
+		}
+	case errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before the given retry, starting at 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	d, limit := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = 100 * time.Millisecond
+	}
+	if limit <= 0 {
+		limit = 10 * time.Second
+	}
+	for i := 1; i < retry && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// do calls f until it succeeds, fails with an error which is not
+// retryable, or the attempts are exhausted. f is passed the number of
+// attempts left, or 0 if the call is not retried, and returns the number
+// of requests it made, each counting as an attempt. A nil policy calls f
+// once.
+func (p *RetryPolicy) do(ctx context.Context, method string, f func(max int) (Array, int, error)) (Array, error) {
+	if p == nil || p.MaxAttempts < 2 {
+		v, _, err := f(0)
+		return v, err
+	}
+	replay := p.allows(method)
+	v, attempts, err := f(p.MaxAttempts)
+	for retry := 1; err != nil && attempts < p.MaxAttempts; retry++ {
+		if ctx.Err() != nil || !p.retryable(err) || !replay && !unsent(err) {
+			break
+		}
+		t := time.NewTimer(p.backoff(retry))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		var n int
+		v, n, err = f(p.MaxAttempts - attempts)
+		attempts += n
+	}
+	return v, err
+}
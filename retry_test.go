@@ -0,0 +1,110 @@
+package xmlrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryStatus(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		Marshal(w, "", "done")
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	if _, err := client.Call("Irrelevant"); err == nil {
+		t.Fatal("expected error without retry policy")
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client.Retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Jitter: 0.5}
+	if _, err := client.Call("Irrelevant"); err == nil || calls != 1 {
+		t.Fatalf("sent calls should not be replayed without Methods (%v after %d calls)", err, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client.Retry.AllMethods = true
+	v, err := client.Call("Irrelevant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{"done"}) || calls != 3 {
+		t.Fatalf("unexpected response %+v after %d calls", v, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client.Retry.MaxAttempts = 2
+	if _, err := client.Call("Irrelevant"); err == nil {
+		t.Fatal("expected error after 2 attempts")
+	} else if se, ok := err.(*StatusError); !ok || se.Code != http.StatusServiceUnavailable {
+		t.Fatalf("want StatusError but got %#v", err)
+	}
+}
+
+func TestRetryFault(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>42</int></value></member>
+<member><name>faultString</name><value>busy</value></member>
+</struct></value></fault></methodResponse>`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	client.Retry = &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Methods: []string{"get"}}
+	if _, err := client.Call("get"); err == nil || calls != 1 {
+		t.Fatalf("unlisted fault should not be retried (%v after %d calls)", err, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client.Retry.FaultCodes = []int{42}
+	if _, err := client.Call("get"); err == nil || calls != 3 {
+		t.Fatalf("fault should be retried (%v after %d calls)", err, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	if _, err := client.Call("set"); err == nil || calls != 1 {
+		t.Fatalf("unlisted method should not be retried (%v after %d calls)", err, calls)
+	}
+}
+
+func TestRetryNetwork(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	url := ts.URL
+	ts.Close()
+
+	client := NewClient(url)
+	client.Retry = &RetryPolicy{MaxAttempts: 5, Backoff: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.CallContext(ctx, "Irrelevant"); err != context.DeadlineExceeded {
+		t.Fatalf("want %v but got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if d := p.backoff(i + 1); d != want {
+			t.Fatalf("retry %d: want %v but got %v", i+1, want, d)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(1); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("backoff %v out of jitter range", d)
+		}
+	}
+}
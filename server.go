@@ -0,0 +1,159 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"net/rpc"
+	"runtime/debug"
+	"strings"
+)
+
+// Method serves a call with its args, returning the result sent back as
+// the param of the response.
+type Method func(r *http.Request, args Array) (interface{}, error)
+
+// Dispatch serves a call to method with args, returning its result.
+type Dispatch func(r *http.Request, method string, args Array) (interface{}, error)
+
+// Middleware wraps the dispatch of the calls served by a Handler,
+// proceeding by calling next. It may change the method or args, and the
+// result or error returned.
+type Middleware func(r *http.Request, method string, args Array, next Dispatch) (interface{}, error)
+
+// Handler serves XMLRPC calls over HTTP. The errors returned by methods
+// and middleware are sent as faults, as mapped by FaultMapper. Requests
+// compressed with gzip or deflate are accepted, and responses are
+// compressed according to their Accept-Encoding.
+type Handler struct {
+	// Methods maps the method names to the functions serving them.
+	Methods map[string]Method
+	// Server, if non-nil, serves the calls to the methods missing from
+	// Methods with its net/rpc services. Method names are the net/rpc
+	// "Service.Method" names. A single param is assigned to the args of
+	// the method, and several params to the fields of its args struct in
+	// order. As net/rpc only keeps the message of the errors returned by
+	// its methods, they are all mapped as errors without a code; see
+	// Register for keeping them.
+	Server *rpc.Server
+	// Middleware wraps the dispatch of every call, the first one
+	// outermost.
+	Middleware []Middleware
+	// NamespaceMiddleware wraps, inside Middleware, the dispatch of the
+	// calls to the methods of a namespace, the part of the method name
+	// before its last dot, as in "system" for "system.listMethods".
+	NamespaceMiddleware map[string][]Middleware
+	// ErrorLog logs the methods which panic, with their stack. If nil,
+	// the log package's standard logger is used.
+	ErrorLog *log.Logger
+	// PanicCode is the code of the fault returned when a method panics.
+	// Zero means CodeInternalError.
+	PanicCode int
+	// FaultMapper converts the errors returned by methods and middleware
+	// into faults. If nil, DefaultFaultMapper is used.
+	FaultMapper *FaultMapper
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := decompress(r.Header.Get("Content-Encoding"), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	cw := compressResponse(w, r)
+	defer cw.Close()
+	enc := NewEncoder(cw)
+
+	name, params, err := NewDecoder(body).Decode()
+	if err == nil && name == "" {
+		err = errors.New("invalid request: missing methodCall")
+	}
+	if err != nil {
+		code := CodeInvalidRequest
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			code = CodeParseError
+		}
+		enc.EncodeFault(NewFault(code, err.Error()))
+		return
+	}
+
+	v, err := h.call(r, name, params)
+	if err != nil {
+		enc.EncodeFault(h.fault(err))
+		return
+	}
+	// Encode the whole response first, so that a result which cannot be
+	// encoded gives a fault rather than a truncated document.
+	var buf bytes.Buffer
+	if err := Marshal(&buf, "", v); err != nil {
+		enc.EncodeFault(h.fault(err))
+		return
+	}
+	cw.Write(buf.Bytes())
+}
+
+// call dispatches a call through the middleware, turning a panic into a
+// fault.
+func (h *Handler) call(r *http.Request, method string, args Array) (v interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			logf := log.Printf
+			if h.ErrorLog != nil {
+				logf = h.ErrorLog.Printf
+			}
+			logf("xmlrpc: panic serving %s: %v\n%s", method, p, debug.Stack())
+			code := h.PanicCode
+			if code == 0 {
+				code = CodeInternalError
+			}
+			v, err = nil, NewFault(code, "internal error")
+		}
+	}()
+	middleware := h.Middleware
+	if i := strings.LastIndex(method, "."); i >= 0 {
+		if ns := h.NamespaceMiddleware[method[:i]]; len(ns) > 0 {
+			middleware = append(middleware[:len(middleware):len(middleware)], ns...)
+		}
+	}
+	return chainMiddleware(middleware, h.dispatch)(r, method, args)
+}
+
+// fault converts err into a fault using the FaultMapper of h.
+func (h *Handler) fault(err error) *Fault {
+	if h.FaultMapper != nil {
+		return h.FaultMapper.Fault(err)
+	}
+	return ToFault(err)
+}
+
+// dispatch calls the method serving method.
+func (h *Handler) dispatch(r *http.Request, method string, args Array) (interface{}, error) {
+	if m, ok := h.Methods[method]; ok {
+		return m(r, args)
+	}
+	if h.Server != nil {
+		return serveRPC(h.Server, method, args)
+	}
+	return nil, NewFault(CodeMethodNotFound, "method not found: "+method)
+}
+
+// chainMiddleware returns f wrapped by middleware, the first one
+// outermost.
+func chainMiddleware(middleware []Middleware, f Dispatch) Dispatch {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		m, next := middleware[i], f
+		f = func(r *http.Request, method string, args Array) (interface{}, error) {
+			return m(r, method, args, next)
+		}
+	}
+	return f
+}
@@ -0,0 +1,183 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sum(r *http.Request, args Array) (interface{}, error) {
+	n := 0
+	for _, arg := range args {
+		i, ok := arg.(int)
+		if !ok {
+			return nil, fmt.Errorf("not an int: %v", arg)
+		}
+		n += i
+	}
+	return n, nil
+}
+
+func TestHandler(t *testing.T) {
+	ts := httptest.NewServer(&Handler{Methods: map[string]Method{"math.sum": sum}})
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	v, err := client.Call("math.sum", 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{6}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+	if _, err := client.Call("math.sum", "1"); !errors.Is(err, ErrApplicationError) {
+		t.Fatalf("want application error fault but got %v", err)
+	}
+	if _, err := client.Call("math.product", 1); !errors.Is(err, ErrMethodNotFound) {
+		t.Fatalf("want method not found fault but got %v", err)
+	}
+
+	resp, err := http.Post(ts.URL, "text/xml", strings.NewReader("<methodCall><methodName>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, _, err := Unmarshal(resp.Body); !errors.Is(err, ErrParseError) {
+		t.Fatalf("want %v but got %v", ErrParseError, err)
+	}
+
+	resp, err = http.Post(ts.URL, "text/xml", strings.NewReader("<methodResponse><params></params></methodResponse>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, _, err := Unmarshal(resp.Body); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("want %v but got %v", ErrInvalidRequest, err)
+	}
+
+	resp, err = http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("want status %d but got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	var logBuf bytes.Buffer
+	ts := httptest.NewServer(&Handler{
+		Methods: map[string]Method{"math.sum": sum, "crash": func(r *http.Request, args Array) (interface{}, error) {
+			panic("boom")
+		}},
+		ErrorLog:  log.New(&logBuf, "", 0),
+		PanicCode: -32000,
+	})
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	_, err := client.Call("crash")
+	var f *Fault
+	if !errors.As(err, &f) || f.Code != -32000 || f.Message != "internal error" {
+		t.Fatalf("want internal error fault but got %v", err)
+	}
+	if log := logBuf.String(); !strings.Contains(log, "panic serving crash: boom") || !strings.Contains(log, "goroutine") {
+		t.Fatalf("panic not logged with its stack: %q", log)
+	}
+	if v, err := client.Call("math.sum", 6, 7); err != nil || !reflect.DeepEqual(v, Array{13}) {
+		t.Fatalf("server unusable after a panic: %v %v", v, err)
+	}
+}
+
+func TestHandlerMiddleware(t *testing.T) {
+	var trace []string
+	ts := httptest.NewServer(&Handler{
+		Methods: map[string]Method{"math.sum": sum, "echo": func(r *http.Request, args Array) (interface{}, error) {
+			return args, nil
+		}},
+		Middleware: []Middleware{
+			func(r *http.Request, method string, args Array, next Dispatch) (interface{}, error) {
+				trace = append(trace, "global "+method)
+				if r.Header.Get("Authorization") == "" {
+					return nil, NewFault(401, "unauthorized")
+				}
+				v, err := next(r, method, args)
+				trace = append(trace, fmt.Sprintf("result %v %v", v, err))
+				return v, err
+			},
+		},
+		NamespaceMiddleware: map[string][]Middleware{
+			"math": {
+				func(r *http.Request, method string, args Array, next Dispatch) (interface{}, error) {
+					trace = append(trace, "math "+method)
+					return next(r, method, append(args, 1))
+				},
+			},
+		},
+	})
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	if _, err := client.Call("math.sum", 1); !errors.Is(err, NewFault(401, "")) {
+		t.Fatalf("want unauthorized fault but got %v", err)
+	}
+	client.BearerToken = "token"
+	v, err := client.Call("math.sum", 5)
+	if err != nil || !reflect.DeepEqual(v, Array{6}) {
+		t.Fatalf("response different from expected (%v, %v)", v, err)
+	}
+	v, err = client.Call("echo", 5)
+	if err != nil || !reflect.DeepEqual(v, Array{Array{5}}) {
+		t.Fatalf("response different from expected (%v, %v)", v, err)
+	}
+	if _, err := client.Call("math.sum", "x"); !errors.Is(err, ErrApplicationError) {
+		t.Fatalf("want application error fault but got %v", err)
+	}
+	want := []string{
+		"global math.sum",
+		"global math.sum",
+		"math math.sum",
+		"result 6 <nil>",
+		"global echo",
+		"result [5] <nil>",
+		"global math.sum",
+		"math math.sum",
+		"result <nil> not an int: x",
+	}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("unexpected middleware trace\n got %q\nwant %q", trace, want)
+	}
+}
+
+func TestHandlerFaultMapper(t *testing.T) {
+	ts := httptest.NewServer(&Handler{
+		Methods: map[string]Method{
+			"fail": func(r *http.Request, args Array) (interface{}, error) {
+				return nil, errors.New("disk full")
+			},
+			"quota": func(r *http.Request, args Array) (interface{}, error) {
+				return nil, fmt.Errorf("get: %w", codedError{})
+			},
+		},
+		FaultMapper: &FaultMapper{DefaultCode: CodeInternalError, HideMessages: true},
+	})
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	_, err := client.Call("fail")
+	var f *Fault
+	if !errors.As(err, &f) || f.Code != CodeInternalError || f.Message != "internal error" {
+		t.Fatalf("want hidden internal error fault but got %v", err)
+	}
+	_, err = client.Call("quota")
+	if !errors.As(err, &f) || f.Code != 429 || f.Message != "get: quota exceeded" {
+		t.Fatalf("want quota fault but got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package xmlrpc
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// EnableCookies gives the client its own cookie jar, so that cookies set
+// by the server, such as the session cookie returned by a login call, are
+// sent with later calls. The HttpClient is copied so that an http.Client
+// shared with other code is left untouched.
+func (c *Client) EnableCookies() {
+	jar, _ := cookiejar.New(nil) // never fails without options
+	hc := http.Client{}
+	if c.HttpClient != nil {
+		hc = *c.HttpClient
+	}
+	hc.Jar = jar
+	c.HttpClient = &hc
+}
+
+// PrependArg returns a SessionHook which sends v as the first argument of
+// every call, as used by APIs taking a session token or key as their first
+// parameter.
+func PrependArg(v interface{}) func(method string, args []interface{}) []interface{} {
+	return func(method string, args []interface{}) []interface{} {
+		return append([]interface{}{v}, args...)
+	}
+}
+
+// StructArg returns a SessionHook which sets the member name to v in the
+// Struct passed as first argument, as Bugzilla expects its token. A Struct
+// is prepended if the first argument is not one. The caller's Struct is
+// not modified.
+func StructArg(name string, v interface{}) func(method string, args []interface{}) []interface{} {
+	return func(method string, args []interface{}) []interface{} {
+		st := Struct{name: v}
+		if len(args) == 0 {
+			return []interface{}{st}
+		}
+		var m map[string]interface{}
+		switch a := args[0].(type) {
+		case Struct:
+			m = a
+		case map[string]interface{}:
+			m = a
+		default:
+			return append([]interface{}{st}, args...)
+		}
+		for k, mv := range m {
+			if k != name {
+				st[k] = mv
+			}
+		}
+		return append([]interface{}{st}, args[1:]...)
+	}
+}
@@ -0,0 +1,97 @@
+package xmlrpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClientCookies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, _, err := Unmarshal(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if name == "User.login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t"})
+			Marshal(w, "", true)
+			return
+		}
+		c, err := r.Cookie("session")
+		Marshal(w, "", err == nil && c.Value == "s3cr3t")
+	}))
+	defer ts.Close()
+
+	shared := &http.Client{}
+	client := NewClient(ts.URL)
+	client.HttpClient = shared
+	client.EnableCookies()
+	if shared.Jar != nil {
+		t.Fatal("shared http.Client should not be modified")
+	}
+
+	if _, err := client.Call("User.login", "user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := client.Call("Bug.get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{true}) {
+		t.Fatalf("session cookie was not sent (%+v)", v)
+	}
+
+	v, err = NewClient(ts.URL).Call("Bug.get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{false}) {
+		t.Fatalf("session cookie should not be shared (%+v)", v)
+	}
+}
+
+func TestSessionHook(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, args, err := Unmarshal(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		Marshal(w, "", args...)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	client.SessionHook = PrependArg("token")
+	v, err := client.Call("echo", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{"token", 1}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+
+	client.SessionHook = StructArg("Bugzilla_token", "token")
+	params := Struct{"ids": 1}
+	v, err = client.Call("Bug.get", params, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Array{Struct{"ids": 1, "Bugzilla_token": "token"}, 2}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+	if len(params) != 1 {
+		t.Fatalf("caller's Struct was modified (%+v)", params)
+	}
+
+	v, err = client.Call("Bugzilla.version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{Struct{"Bugzilla_token": "token"}}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+}
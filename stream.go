@@ -0,0 +1,611 @@
+package xmlrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Base64Reader is an argument encoded as base64, like a []byte, whose
+// contents are read from the Reader while encoding. Used with Client.Stream
+// it sends large contents, such as the file of
+// metaWeblog.newMediaObject, without holding them in memory. The Reader
+// is consumed by the first attempt of the call, so further attempts, as
+// with retries or failover, fail with ErrStreamReplay.
+type Base64Reader struct {
+	io.Reader
+}
+
+// encodeError marks the errors of encoding a streamed request, so that
+// they can be told apart from errors sending it.
+type encodeError struct {
+	err error
+}
+
+func (e *encodeError) Error() string { return e.err.Error() }
+
+func (e *encodeError) Unwrap() error { return e.err }
+
+// callerError marks the errors of the caller, such as those of the
+// destinations of CallInto or the visitor of CallWalk, which are not
+// failures of the server.
+type callerError struct {
+	err error
+}
+
+func (e *callerError) Error() string { return e.err.Error() }
+
+func (e *callerError) Unwrap() error { return e.err }
+
+// isCallerError reports whether err is an error of the caller.
+func isCallerError(err error) bool {
+	var ce *callerError
+	return errors.As(err, &ce)
+}
+
+// unwrapCallerError returns the error of the caller err holds, if any.
+func unwrapCallerError(err error) error {
+	var ce *callerError
+	if errors.As(err, &ce) {
+		return ce.err
+	}
+	return err
+}
+
+// partialError marks the errors of calls which already passed part of
+// their response to the caller, writing to an io.Writer of CallInto or
+// calling the visitor of CallWalk. As that cannot be undone, they are not
+// retried nor failed over, though they count as failures of the server.
+type partialError struct {
+	err error
+}
+
+func (e *partialError) Error() string { return e.err.Error() }
+
+func (e *partialError) Unwrap() error { return e.err }
+
+// isPartialError reports whether err ended a call after part of its
+// response was passed to the caller.
+func isPartialError(err error) bool {
+	var pe *partialError
+	return errors.As(err, &pe)
+}
+
+// unwrapPartialError returns the error err marks as partial, if any.
+func unwrapPartialError(err error) error {
+	var pe *partialError
+	if errors.As(err, &pe) {
+		return pe.err
+	}
+	return err
+}
+
+// markWriter sets wrote once something is written to w.
+type markWriter struct {
+	w     io.Writer
+	wrote *bool
+}
+
+func (mw markWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		*mw.wrote = true
+	}
+	return mw.w.Write(p)
+}
+
+// ErrStreamReplay is returned by attempts of a streamed call after the
+// first one, if the first one read a Base64Reader, since its contents
+// cannot be sent again.
+var ErrStreamReplay = errors.New("cannot send a Base64Reader again")
+
+// requestStream encodes the bodies of the attempts of a streamed call.
+type requestStream struct {
+	opts   EncoderOptions
+	coding string
+	name   string
+	args   []interface{}
+
+	mu         sync.Mutex
+	done       chan struct{} // closed when the last encoding ends
+	readBase64 int32         // set once an encoding has read a Base64Reader
+}
+
+func newRequestStream(opts EncoderOptions, coding, name string, args []interface{}) *requestStream {
+	return &requestStream{opts: opts, coding: coding, name: name, args: args}
+}
+
+// body returns a body streaming the encoded and compressed methodCall,
+// or ErrStreamReplay if a previous encoding read a Base64Reader. The
+// encoding starts on the first read of the body, so that nothing is left
+// running for a request which is never sent.
+func (s *requestStream) body() (io.Reader, error) {
+	s.mu.Lock()
+	prev := s.done
+	s.mu.Unlock()
+	if prev != nil {
+		<-prev
+		if atomic.LoadInt32(&s.readBase64) != 0 {
+			return nil, ErrStreamReplay
+		}
+	}
+	return &streamBody{start: s.start}, nil
+}
+
+// start starts an encoding once the previous one, if any, has ended, and
+// fails it with ErrStreamReplay if the previous one read a Base64Reader,
+// as when the body returned by GetBody was read first.
+func (s *requestStream) start() *io.PipeReader {
+	done := make(chan struct{})
+	s.mu.Lock()
+	prev := s.done
+	s.done = done
+	s.mu.Unlock()
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer close(done)
+		if prev != nil {
+			<-prev
+			if atomic.LoadInt32(&s.readBase64) != 0 {
+				pw.CloseWithError(&encodeError{ErrStreamReplay})
+				return
+			}
+		}
+		cw, err := compressWriter(s.coding, pw)
+		if err == nil {
+			enc := NewEncoder(cw)
+			enc.EncoderOptions = s.opts
+			err = enc.Encode(s.name, s.args...)
+			if enc.readBase64 {
+				atomic.StoreInt32(&s.readBase64, 1)
+			}
+			if cerr := cw.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			err = &encodeError{err}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// streamBody is a request body started on its first read.
+type streamBody struct {
+	start func() *io.PipeReader
+
+	mu     sync.Mutex
+	r      *io.PipeReader
+	closed bool
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.r == nil {
+		if b.closed {
+			b.mu.Unlock()
+			return 0, io.ErrClosedPipe
+		}
+		b.r = b.start()
+	}
+	r := b.r
+	b.mu.Unlock()
+	return r.Read(p)
+}
+
+// Close stops the encoding, if started.
+func (b *streamBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.r != nil {
+		return b.r.Close()
+	}
+	return nil
+}
+
+// rawReader is the reader under an xml.Decoder. As the decoder reads it a
+// byte at a time and never past the '>' of a start element, base64 values
+// can be decoded straight from it rather than from a token holding them.
+// Read returns no more than what is buffered, so that the decoder does not
+// read ahead of the bytes it needs even if it stops using ReadByte.
+type rawReader struct {
+	r       *bufio.Reader
+	last    [2]byte // the last bytes read
+	pending []byte  // bytes to be read again
+}
+
+func newRawReader(r io.Reader) *rawReader {
+	return &rawReader{r: bufio.NewReader(r)}
+}
+
+func (rr *rawReader) ReadByte() (byte, error) {
+	if len(rr.pending) > 0 {
+		b := rr.pending[0]
+		rr.pending = rr.pending[1:]
+		return b, nil
+	}
+	b, err := rr.r.ReadByte()
+	if err == nil {
+		rr.last[0], rr.last[1] = rr.last[1], b
+	}
+	return b, err
+}
+
+func (rr *rawReader) Read(p []byte) (int, error) {
+	n := 0
+	for ; n < len(p); n++ {
+		if n > 0 && len(rr.pending) == 0 && rr.r.Buffered() == 0 {
+			break
+		}
+		b, err := rr.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		p[n] = b
+	}
+	return n, nil
+}
+
+// readRaw is like ReadByte but reports the end of input as unexpected.
+func (rr *rawReader) readRaw() (byte, error) {
+	b, err := rr.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// empty reports whether the start element just read was empty, as in
+// <base64/>.
+func (rr *rawReader) empty() bool {
+	return rr.last[0] == '/' && rr.last[1] == '>'
+}
+
+// expect reads s, failing if anything else comes.
+func (rr *rawReader) expect(s string) error {
+	for i := 0; i < len(s); i++ {
+		b, err := rr.readRaw()
+		if err != nil {
+			return err
+		}
+		if b != s[i] {
+			return fmt.Errorf("unexpected %q in base64", b)
+		}
+	}
+	return nil
+}
+
+// until reads up to and including term, passing the bytes before it to
+// fn.
+func (rr *rawReader) until(term string, fn func(byte) error) error {
+	win := make([]byte, 0, 2*len(term))
+	for {
+		b, err := rr.readRaw()
+		if err != nil {
+			return err
+		}
+		if len(win) == cap(win) {
+			win = append(win[:0], win[len(win)-len(term):]...)
+		}
+		win = append(win, b)
+		if len(win) > len(term) {
+			if err := fn(win[len(win)-len(term)-1]); err != nil {
+				return err
+			}
+		}
+		if len(win) >= len(term) && string(win[len(win)-len(term):]) == term {
+			return nil
+		}
+	}
+}
+
+// decodeBase64 decodes the character data of a base64 element to w, up to
+// its end element, which is left to be read by the decoder. CDATA
+// sections and comments are allowed, but not elements.
+func (rr *rawReader) decodeBase64(w io.Writer) error {
+	const chunk = 4096 // a multiple of 4 to decode whole quanta
+	var (
+		buf = make([]byte, 0, chunk)
+		out = make([]byte, base64.StdEncoding.DecodedLen(chunk))
+	)
+	flush := func() error {
+		n, err := base64.StdEncoding.Decode(out, buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[:0]
+		if _, err = w.Write(out[:n]); err != nil {
+			return &callerError{err}
+		}
+		return nil
+	}
+	add := func(b byte) error {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			return nil
+		}
+		buf = append(buf, b)
+		if len(buf) == chunk {
+			return flush()
+		}
+		return nil
+	}
+	skip := func(byte) error { return nil }
+	for {
+		b, err := rr.readRaw()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case '&':
+			if b, err = rr.readReference(); err != nil {
+				return err
+			}
+		case '<':
+			if b, err = rr.readRaw(); err != nil {
+				return err
+			}
+			switch b {
+			case '/':
+				rr.pending = append(rr.pending[:0], '<', '/')
+				return flush()
+			case '!':
+				if b, err = rr.readRaw(); err != nil {
+					return err
+				}
+				if b == '-' {
+					// "--" may only end a comment
+					err = rr.expect("-")
+					if err == nil {
+						err = rr.until("--", skip)
+					}
+					if err == nil {
+						err = rr.expect(">")
+					}
+				} else if b == '[' {
+					err = rr.expect("CDATA[")
+					if err == nil {
+						err = rr.until("]]>", add)
+					}
+				} else {
+					err = fmt.Errorf("unexpected <!%c in base64", b)
+				}
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			return fmt.Errorf("unexpected <%c in base64", b)
+		}
+		if err := add(b); err != nil {
+			return err
+		}
+	}
+}
+
+// readReference reads the rest of an entity or character reference whose
+// '&' was just read and returns the ASCII character it stands for.
+func (rr *rawReader) readReference() (byte, error) {
+	var ref []byte
+	for len(ref) < 10 {
+		b, err := rr.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ';' {
+			ref = append(ref, b)
+			continue
+		}
+		s := string(ref)
+		switch s {
+		case "amp":
+			return '&', nil
+		case "lt":
+			return '<', nil
+		case "gt":
+			return '>', nil
+		case "quot":
+			return '"', nil
+		case "apos":
+			return '\'', nil
+		}
+		var n uint64
+		if strings.HasPrefix(s, "#x") {
+			n, err = strconv.ParseUint(s[2:], 16, 8)
+		} else if strings.HasPrefix(s, "#") {
+			n, err = strconv.ParseUint(s[1:], 10, 8)
+		} else {
+			break
+		}
+		if err != nil || n >= utf8.RuneSelf {
+			break
+		}
+		return byte(n), nil
+	}
+	return 0, fmt.Errorf("invalid reference in base64: &%s", ref)
+}
+
+// decodeInto reads the params of the document into dst as described for
+// DecodeInto, and returns them with the writers in place of the values
+// written to them. Errors occurring once something was written to a writer
+// are marked as partial.
+func (dec *Decoder) decodeInto(dst []interface{}) (name string, v Array, err error) {
+	var wrote bool
+	defer func() {
+		if err != nil && wrote && !isCallerError(err) {
+			err = &partialError{err}
+		}
+	}()
+	var raw *rawReader
+	p, name, e := dec.start(&raw)
+	if e != nil {
+		return name, nil, e
+	}
+	se, e := nextStart(p)
+	if e != nil {
+		return name, nil, e
+	}
+	if se.Name.Local != "params" {
+		_, v, e := nextElmt(p, se) // a fault gives its error
+		if e == nil {
+			e = fmt.Errorf("wanted params, got %#v", v)
+		}
+		return name, nil, e
+	}
+	params := make(Array, 0, len(dst))
+	for {
+		t, e := p.Token()
+		if e != nil {
+			return name, nil, e
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "param" {
+				return name, nil, errors.New("expected param")
+			}
+			var d interface{}
+			if len(params) < len(dst) {
+				d = dst[len(params)]
+			}
+			v, e := nextParamInto(p, raw, d, &wrote)
+			if e != nil {
+				return name, nil, e
+			}
+			params = append(params, v)
+		case xml.EndElement:
+			if t.Name.Local == "params" {
+				return name, params, nil
+			}
+		}
+	}
+}
+
+// nextParamInto reads the value of a param into dst.
+func nextParamInto(p *xml.Decoder, raw *rawReader, dst interface{}, wrote *bool) (interface{}, error) {
+	w, ok := dst.(io.Writer)
+	if !ok {
+		_, v, e := nextValue(p)
+		if e != nil || dst == nil {
+			return v, e
+		}
+		rv := reflect.ValueOf(dst)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() {
+			return nil, &callerError{errors.New("destination must be a non-nil pointer or an io.Writer")}
+		}
+		if e := assign(rv.Elem(), v); e != nil {
+			return v, &callerError{e}
+		}
+		return v, nil
+	}
+
+	var (
+		str   string
+		v     interface{}
+		typed bool
+		depth int // 1 inside value
+	)
+	for {
+		t, e := p.Token()
+		if e != nil {
+			return nil, e
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				if t.Name.Local != "value" {
+					return nil, errors.New("expected value")
+				}
+				depth++
+				continue
+			}
+			typed = true
+			if t.Name.Local == "base64" {
+				if !raw.empty() {
+					if e := raw.decodeBase64(markWriter{w, wrote}); e != nil {
+						return nil, e
+					}
+				}
+				t, e := p.Token()
+				if e != nil {
+					return nil, e
+				}
+				if end, ok := t.(xml.EndElement); !ok || end.Name.Local != "base64" {
+					return nil, fmt.Errorf("unexpected %T in base64", t)
+				}
+				v = w
+				continue
+			}
+			if _, v, e = nextElmt(p, &t); e != nil {
+				return nil, e
+			}
+		case xml.CharData:
+			if depth == 1 {
+				str += string(t)
+			}
+		case xml.EndElement:
+			if t.Name.Local != "value" {
+				// </param>
+				if !typed {
+					v = str
+				}
+				if e := writeValue(markWriter{w, wrote}, v); e != nil {
+					return v, &callerError{e}
+				}
+				return v, nil
+			}
+			depth--
+		}
+	}
+}
+
+// writeValue writes v, a value decoded for a param, to w.
+func writeValue(w io.Writer, v interface{}) error {
+	var err error
+	switch v := v.(type) {
+	case io.Writer, nil:
+	case []byte:
+		_, err = w.Write(v)
+	case string:
+		_, err = io.WriteString(w, v)
+	default:
+		err = fmt.Errorf("cannot write %T to io.Writer", v)
+	}
+	return err
+}
+
+// DecodeInto is like Decode but stores the params into dst, in order. A
+// param is assigned to the value its dst points to, or written to its dst
+// if that is an io.Writer, such as a file. Base64 values written to an
+// io.Writer are decoded incrementally from the input rather than held in
+// memory. Params without a dst, or with a nil one, are discarded.
+func (dec *Decoder) DecodeInto(dst ...interface{}) (string, error) {
+	name, _, err := dec.decodeInto(dst)
+	return name, unwrapPartialError(unwrapCallerError(err))
+}
+
+// CallInto calls name with args like CallContext, storing the params of
+// the response into reply as Decoder.DecodeInto does, so that a large
+// base64 value can be streamed to an io.Writer such as a file.
+// Interceptors see the writers in place of the values written to them.
+// Errors storing the params do not count as failures of the server. Since
+// a partial write cannot be undone, a call failing once something was
+// written to an io.Writer is not retried nor failed over.
+func (c *Client) CallInto(ctx context.Context, reply []interface{}, name string, args ...interface{}) error {
+	_, err := c.invoke(ctx, name, args, func(dec *Decoder) (Array, error) {
+		_, v, err := dec.decodeInto(reply)
+		return v, err
+	})
+	return err
+}
@@ -0,0 +1,369 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStreamRequest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decompress(r.Header.Get("Content-Encoding"), r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, args, err := Unmarshal(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, _ := args[1].([]byte)
+		sum := sha256.Sum256(b)
+		chunked := len(r.TransferEncoding) == 1 && r.TransferEncoding[0] == "chunked"
+		Marshal(w, "", args[0], sum[:], chunked)
+	}))
+	defer ts.Close()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	data = append(data, "tail"...) // not a multiple of 3
+	sum := sha256.Sum256(data)
+
+	for _, coding := range []string{"", "gzip"} {
+		client := NewClient(ts.URL)
+		client.Stream = true
+		client.ContentEncoding = coding
+		v, err := client.Call("metaWeblog.newMediaObject", "file.bin", Base64Reader{bytes.NewReader(data)})
+		if err != nil {
+			t.Fatalf("%q: %s", coding, err)
+		}
+		if !reflect.DeepEqual(v, Array{"file.bin", sum[:], true}) {
+			t.Fatalf("%q: response different from expected (%+v)", coding, v)
+		}
+	}
+
+	client := NewClient(ts.URL)
+	v, err := client.Call("upload", "file.bin", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{"file.bin", sum[:], false}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+}
+
+func TestStreamRequestError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		Marshal(w, "", true)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	client.Stream = true
+	if _, err := client.Call("Irrelevant", "a", complex(1, 2)); err != UnsupportedType {
+		t.Fatalf("want %v but got %v", UnsupportedType, err)
+	}
+	client.ContentEncoding = "br"
+	if _, err := client.Call("Irrelevant"); err == nil {
+		t.Fatal("expected error for unsupported encoding")
+	}
+}
+
+func TestStreamRequestNotSent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Marshal(w, "", true)
+	}))
+	defer ts.Close()
+
+	before := runtime.NumGoroutine()
+	hookErr := errors.New("hook failed")
+	client := NewClient(ts.URL)
+	client.Stream = true
+	client.RequestHook = func(req *http.Request, method string) error { return hookErr }
+	for i := 0; i < 20; i++ {
+		if _, err := client.Call("Irrelevant", "a"); err != hookErr {
+			t.Fatalf("want %v but got %v", hookErr, err)
+		}
+	}
+	client = NewClient("://invalid")
+	client.Stream = true
+	for i := 0; i < 20; i++ {
+		if _, err := client.Call("Irrelevant", "a"); err == nil {
+			t.Fatal("expected error for invalid URL")
+		}
+	}
+	waitFor(t, "encodings to end", func() bool { return runtime.NumGoroutine() <= before+2 })
+}
+
+func TestStreamRequestGetBody(t *testing.T) {
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		Marshal(w, "", true)
+	}))
+	defer ts.Close()
+
+	var logged []byte
+	client := NewClient(ts.URL)
+	client.Stream = true
+	client.HTTPInterceptors = []HTTPInterceptor{
+		func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			logged, _ = ioutil.ReadAll(body)
+			body.Close()
+			return next(req)
+		},
+	}
+	if _, err := client.Call("greet", "world"); err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) == 0 || !bytes.Equal(logged, received) {
+		t.Fatalf("GetBody gave %q but %q was sent", logged, received)
+	}
+}
+
+func TestStreamRequestReplay(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		io.Copy(ioutil.Discard, r.Body)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	client.Stream = true
+	client.Retry = &RetryPolicy{MaxAttempts: 3, AllMethods: true, Backoff: time.Millisecond}
+	if _, err := client.Call("upload", "a"); !isStatus(err, http.StatusServiceUnavailable) || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("calls without a Base64Reader should be retried (%v, %d calls)", err, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	data := Base64Reader{bytes.NewReader([]byte("contents"))}
+	if _, err := client.Call("upload", data); err != ErrStreamReplay {
+		t.Fatalf("want %v but got %v", ErrStreamReplay, err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("want 1 call but got %d", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client = NewMultiClient(ts.URL, ts.URL)
+	client.Stream = true
+	client.Retry = &RetryPolicy{MaxAttempts: 2, AllMethods: true}
+	data = Base64Reader{bytes.NewReader([]byte("contents"))}
+	if _, err := client.Call("upload", data); err != ErrStreamReplay {
+		t.Fatalf("want %v but got %v", ErrStreamReplay, err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("want 1 call but got %d", calls)
+	}
+}
+
+func isStatus(err error, code int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == code
+}
+
+func TestDecodeInto(t *testing.T) {
+	payload := `<?xml version="1.0"?>
+<methodResponse><params>
+<param><value><base64>aGVsbG8g
+d29y&#13;
+bGQ=</base64></value></param>
+<param><value><i4>42</i4></value></param>
+<param><value><struct><member><name>A</name><value><int>1</int></value></member></struct></value></param>
+<param><value>raw text</value></param>
+<param><value><base64/></value></param>
+<param><value>skipped</value></param>
+</params></methodResponse>`
+
+	var (
+		file  bytes.Buffer
+		n     int
+		st    struct{ A int }
+		text  bytes.Buffer
+		empty bytes.Buffer
+	)
+	name, err := NewDecoder(bytes.NewReader([]byte(payload))).DecodeInto(&file, &n, &st, &text, &empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "" || file.String() != "hello world" || n != 42 || st.A != 1 || text.String() != "raw text" || empty.Len() != 0 {
+		t.Fatalf("unexpected values %q %q %d %+v %q", name, file.String(), n, st, text.String())
+	}
+
+	var s string
+	if _, err := NewDecoder(bytes.NewReader([]byte(payload))).DecodeInto(nil, &s); err == nil {
+		t.Fatal("expected error assigning int to string")
+	}
+	if _, err := NewDecoder(bytes.NewReader([]byte(payload))).DecodeInto(nil, &file); err == nil {
+		t.Fatal("expected error writing int to io.Writer")
+	}
+
+	fault := `<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>4</int></value></member>
+<member><name>faultString</name><value>denied</value></member>
+</struct></value></fault></methodResponse>`
+	if _, err := NewDecoder(bytes.NewReader([]byte(fault))).DecodeInto(&file); err == nil || err.Error() != "4: denied" {
+		t.Fatalf("want fault but got %v", err)
+	}
+}
+
+func TestDecodeIntoBase64Markup(t *testing.T) {
+	long := bytes.Repeat([]byte("0123456789"), 1000)
+	enc := base64.StdEncoding.EncodeToString(long)
+	tests := []struct {
+		base64 string
+		want   string
+	}{
+		{"<![CDATA[aGVsbG8=]]>", "hello"},
+		{"aGVs<!-- c -->bG8=", "hello"},
+		{"aGVs<!-- a - b -->bG8=", "hello"},
+		{"aG<![CDATA[Vs]]><!----><![CDATA[]]>bG8=", "hello"},
+		{"<![CDATA[" + enc[:5000] + "]]>" + enc[5000:], string(long)},
+	}
+	for _, test := range tests {
+		payload := "<methodResponse><params><param><value><base64>" + test.base64 +
+			"</base64></value></param></params></methodResponse>"
+		var buf bytes.Buffer
+		if _, err := NewDecoder(strings.NewReader(payload)).DecodeInto(&buf); err != nil {
+			t.Fatalf("%.40q: %s", test.base64, err)
+		}
+		if buf.String() != test.want {
+			t.Fatalf("%.40q: want %.40q but got %.40q", test.base64, test.want, buf.String())
+		}
+		_, v, err := Unmarshal(strings.NewReader(payload))
+		if err != nil || !reflect.DeepEqual(v, Array{[]byte(test.want)}) {
+			t.Fatalf("%.40q: Unmarshal disagrees (%v)", test.base64, err)
+		}
+	}
+
+	for _, b64 := range []string{"aGVs<b/>bG8=", "aGVs<?pi?>bG8=", "aGVs<!DOCTYPE>", "<![CDATA[aGVs", "aGVs<!-- c", "aGVs<!-- a -- b -->bG8="} {
+		payload := "<methodResponse><params><param><value><base64>" + b64 +
+			"</base64></value></param></params></methodResponse>"
+		if _, err := NewDecoder(strings.NewReader(payload)).DecodeInto(new(bytes.Buffer)); err == nil {
+			t.Fatalf("%q: expected error", b64)
+		}
+	}
+}
+
+func TestDecodeIntoLatin1(t *testing.T) {
+	payload := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>" +
+		"<methodResponse><params><param><value>caf\xe9</value></param>" +
+		"<param><value><base64>AQID</base64></value></param></params></methodResponse>"
+
+	var (
+		s   string
+		bin bytes.Buffer
+	)
+	if _, err := NewDecoder(bytes.NewReader([]byte(payload))).DecodeInto(&s, &bin); err != nil {
+		t.Fatal(err)
+	}
+	if s != "café" || !bytes.Equal(bin.Bytes(), []byte{1, 2, 3}) {
+		t.Fatalf("unexpected values %q %v", s, bin.Bytes())
+	}
+}
+
+func TestCallInto(t *testing.T) {
+	data := bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6}, 300000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Marshal(w, "", "file.bin", data)
+	}))
+	defer ts.Close()
+
+	var (
+		name string
+		file bytes.Buffer
+		seen Array
+	)
+	client := NewClient(ts.URL)
+	client.Interceptors = []Interceptor{
+		func(ctx context.Context, method string, args []interface{}, next Invoker) (Array, error) {
+			// a new context must not lose the reply
+			v, err := next(context.Background(), method, args)
+			seen = v
+			return v, err
+		},
+	}
+	if err := client.CallInto(context.Background(), []interface{}{&name, &file}, "download"); err != nil {
+		t.Fatal(err)
+	}
+	if name != "file.bin" || !bytes.Equal(file.Bytes(), data) {
+		t.Fatalf("unexpected values %q and %d bytes", name, file.Len())
+	}
+	if len(seen) != 2 || seen[0] != "file.bin" || seen[1] != &file {
+		t.Fatalf("unexpected params seen by interceptor %v", seen[0])
+	}
+}
+
+func TestCallIntoCallerError(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		Marshal(w, "", 42)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	client.Breaker = &CircuitBreaker{FailureThreshold: 1}
+	client.Retry = &RetryPolicy{MaxAttempts: 3, AllMethods: true, Retryable: func(error) bool { return true }}
+	var s string
+	for i := 0; i < 2; i++ {
+		err := client.CallInto(context.Background(), []interface{}{&s}, "answer")
+		if err == nil || isCallerError(err) || !strings.Contains(err.Error(), "cannot assign int to string") {
+			t.Fatalf("want assignment error but got %#v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("assignment errors should not be retried (%d calls)", n)
+	}
+	if state := client.Breaker.State(); state != BreakerClosed {
+		t.Fatalf("assignment errors should not open the circuit (%v)", state)
+	}
+}
+
+func TestCallIntoPartial(t *testing.T) {
+	var calls int32
+	truncated := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body := `<?xml version="1.0"?><methodResponse><params><param><value><base64>` +
+			base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("data"), 4096))
+		w.Header().Set("Content-Length", "1000000")
+		io.WriteString(w, body)
+	})
+	a := httptest.NewServer(truncated)
+	defer a.Close()
+	b := httptest.NewServer(truncated)
+	defer b.Close()
+
+	client := NewMultiClient(a.URL, b.URL)
+	client.Retry = &RetryPolicy{MaxAttempts: 3, AllMethods: true, Retryable: func(error) bool { return true }}
+	var file bytes.Buffer
+	err := client.CallInto(context.Background(), []interface{}{&file}, "download")
+	if err == nil || isPartialError(err) {
+		t.Fatalf("want the error of the truncated response but got %#v", err)
+	}
+	if file.Len() == 0 || file.Len() > 4*4096 {
+		t.Fatalf("want one partial copy of the file but got %d bytes", file.Len())
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("calls which wrote to the reply should not be retried (%d calls)", n)
+	}
+}
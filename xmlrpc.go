@@ -2,6 +2,7 @@ package xmlrpc
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/xml"
 	"errors"
@@ -118,17 +119,22 @@ func nextElmt(p *xml.Decoder, se *xml.StartElement) (xml.Name, interface{}, erro
         return nextParams(p)
 
 	case "fault":
-		_, value, _ := next(p)
+		_, value, e := next(p)
+		if e != nil {
+			return xml.Name{}, nil, e
+		}
 		fs, ok := value.(Struct)
 		if !ok {
 			return xml.Name{}, value, fmt.Errorf("fault: wanted Struct, got %#v", value)
 		}
-		var f Fault
+		f := Fault{Data: fs}
         switch code := fs["faultCode"].(type) {
         case string:
-            f.Code, _ = strconv.Atoi(code)
+            f.Code, _ = strconv.Atoi(strings.TrimSpace(code))
         case int:
             f.Code = code
+        case float64:
+            f.Code = int(code)
         }
 		f.Message, _ = fs["faultString"].(string)
 		return xml.Name{}, nil, &f
@@ -282,12 +288,16 @@ func nextParams(p *xml.Decoder) (xml.Name, interface{}, error) {
     }
 }
 
+// nextValue reads the content of a value up to its end. A value without
+// a type element is a string, while the text around a type element is
+// insignificant whitespace.
 func nextValue(p *xml.Decoder) (xml.Name, interface{}, error) {
 
-    var (
-        str   string
-        obj   interface{}
-    )
+	var (
+		str   string
+		obj   interface{}
+		typed bool
+	)
 
 	for {
 		t, e := p.Token()
@@ -298,150 +308,118 @@ func nextValue(p *xml.Decoder) (xml.Name, interface{}, error) {
 		switch t := t.(type) {
 
 		case xml.StartElement:
-            _, v, e := nextElmt(p,&t)
-            if e != nil {
-                return xml.Name{}, nil, e
-            }
-            obj = v
+			_, v, e := nextElmt(p, &t)
+			if e != nil {
+				return xml.Name{}, nil, e
+			}
+			obj, typed = v, true
 
-        case xml.CharData:
-            str += string(t)
+		case xml.CharData:
+			str += string(t)
 
 		case xml.EndElement:
-            if obj == nil {
-                //fmt.Printf("EndElement: %s (str=%+v)\n", t.Name.Local, str)
-                return xml.Name{}, str, nil
-            } else {
-                //fmt.Printf("EndElement: %s (obj=%+v)\n", t.Name.Local, obj)
-                return xml.Name{}, obj, nil
-            }
+			if !typed {
+				return xml.Name{}, str, nil
+			}
+			return xml.Name{}, obj, nil
 		}
 	}
 }
 
 var UnsupportedType = errors.New("unsupported type")
 
-func writeXML(w io.Writer, v interface{}, typ bool) error {
-	if v == nil {
-		_, err := io.WriteString(w, "<nil/>")
-		return err
-	}
-	r := reflect.ValueOf(v)
-	t := r.Type()
-	k := t.Kind()
+// UnsupportedFloat is returned when encoding a NaN or infinite double with
+// the NaNError policy.
+var UnsupportedFloat = errors.New("unsupported float value")
+
+// UnsupportedCycle is returned when encoding a value which contains
+// itself.
+var UnsupportedCycle = errors.New("unsupported cyclic value")
+
+// NaNPolicy controls how NaN and infinite doubles, which XMLRPC cannot
+// represent, are encoded.
+type NaNPolicy int
+
+const (
+	// NaNError fails the encoding with UnsupportedFloat.
+	NaNError NaNPolicy = iota
+	// NaNNil encodes the value as <nil/>.
+	NaNNil
+	// NaNString encodes the value as the string "NaN", "+Inf" or "-Inf".
+	NaNString
+)
 
-	if b, ok := v.([]byte); ok {
-		io.WriteString(w, "<base64>")
-		_, err := base64.NewEncoder(base64.StdEncoding, w).Write(b)
-		io.WriteString(w, "</base64>")
+// writeXML writes v as the content of a value. Strings are written in a
+// string element if typ is true, and as untyped text otherwise; other
+// types are always typed.
+func (o *EncoderOptions) writeXML(w io.Writer, v interface{}, typ bool) error {
+	e := newEncodeState(o, w)
+	defer e.free()
+	if err := e.encode(reflect.ValueOf(v), typ); err != nil {
 		return err
 	}
-
-	switch k {
-	case reflect.Invalid:
-		return UnsupportedType
-	case reflect.Bool:
-		_, err := fmt.Fprintf(w, "<boolean>%v</boolean>", v)
-		return err
-	case reflect.Int,
-		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		reflect.Uint,
-		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		if typ {
-			_, err := fmt.Fprintf(w, "<int>%v</int>", v)
-			return err
-		}
-		_, err := fmt.Fprintf(w, "%v", v)
-		return err
-	case reflect.Uintptr:
-		return UnsupportedType
-	case reflect.Float32, reflect.Float64:
-		if typ {
-			_, err := fmt.Fprintf(w, "<double>%v</double>", v)
-			return err
-		}
-		_, err := fmt.Fprintf(w, "%v", v)
-		return err
-	case reflect.Complex64, reflect.Complex128:
-		return UnsupportedType
-	case reflect.Array:
-		io.WriteString(w, "<array><data>")
-		for n := 0; n < r.Len(); n++ {
-			io.WriteString(w, "<value>")
-			err := writeXML(w, r.Index(n).Interface(), typ)
-			io.WriteString(w, "</value>")
-			if err != nil {
-				return err
-			}
-		}
-		_, err := io.WriteString(w, "</data></array>")
-		return err
-	case reflect.Chan:
-		return UnsupportedType
-	case reflect.Func:
-		return UnsupportedType
-	case reflect.Interface:
-		return writeXML(w, r.Elem(), typ)
-	case reflect.Map:
-		io.WriteString(w, "<struct>")
-		for _, key := range r.MapKeys() {
-			io.WriteString(w, "<member><name>")
-			if err := xml.EscapeText(w, []byte(key.Interface().(string))); err != nil {
-				return err
-			}
-			io.WriteString(w, "</name><value>")
-			if err := writeXML(w, r.MapIndex(key).Interface(), typ); err != nil {
-				return err
-			}
-			if _, err := io.WriteString(w, "</value></member>"); err != nil {
-				return err
-			}
-		}
-		_, err := io.WriteString(w, "</struct>")
-		return err
-	case reflect.Ptr:
-		return UnsupportedType
-	case reflect.Slice:
-		io.WriteString(w, "<array><data>")
-		for n := 0; n < r.Len(); n++ {
-			io.WriteString(w,"<value>")
-			writeXML(w, r.Index(n).Interface(), typ)
-			io.WriteString(w, "</value>")
-		}
-		_, err := io.WriteString(w, "</data></array>")
-		return err
-	case reflect.String:
-		if typ {
-			io.WriteString(w, "<string>")
-		}
-		err := xml.EscapeText(w, []byte(v.(string)))
-		if typ {
-			io.WriteString(w, "</string>")
-		}
-		return err
-	case reflect.Struct:
-		io.WriteString(w, "<struct>")
-		for n := 0; n < r.NumField(); n++ {
-			fmt.Fprintf(w, "<member><name>%s</name><value>", t.Field(n).Name)
-			if err := writeXML(w, r.FieldByIndex([]int{n}).Interface(), true); err != nil {
-				return err
-			}
-			io.WriteString(w, "</value></member>")
-		}
-		_, err := io.WriteString(w, "</struct>")
-		return err
-	case reflect.UnsafePointer:
-		return writeXML(w, r.Elem(), typ)
-	}
-	return nil
+	return e.flush()
 }
 
 // Client is client of XMLRPC
 type Client struct {
 	HttpClient *http.Client
 	url        string
+
+	// EncoderOptions configures how requests are encoded.
+	EncoderOptions EncoderOptions
+	// CharsetReader, if non-nil, is used to decode responses that are
+	// not UTF-8. See Decoder.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+	// Username and Password, if Username is not empty, are sent using
+	// HTTP Basic authentication.
+	Username string
+	Password string
+	// BearerToken, if not empty, is sent as a bearer token in the
+	// Authorization header.
+	BearerToken string
+	// Header holds additional headers sent with every request.
+	Header http.Header
+	// UserAgent is sent in the User-Agent header. Empty means
+	// DefaultUserAgent.
+	UserAgent string
+	// RequestHook, if non-nil, is called with every request before it is
+	// sent, e.g. to set per-call headers. A non-nil error aborts the call.
+	RequestHook func(req *http.Request, method string) error
+	// SessionHook, if non-nil, returns the arguments actually sent for a
+	// call to method, e.g. to add a session token returned by a login
+	// call. See PrependArg and StructArg.
+	SessionHook func(method string, args []interface{}) []interface{}
+	// Retry, if non-nil, retries calls failing with transient errors.
+	Retry *RetryPolicy
+	// Concurrency, if non-nil, bounds the number of calls in flight,
+	// including those started by Go.
+	Concurrency *ConcurrencyLimit
+	// RateLimit, if non-nil, delays calls to stay within its rates.
+	RateLimit *RateLimit
+	// Breaker, if non-nil, fails calls fast while the server is failing.
+	Breaker *CircuitBreaker
+	// ContentEncoding, if "gzip" or "deflate", compresses requests with
+	// that HTTP content coding. Not every server supports it. Compressed
+	// responses are always supported.
+	ContentEncoding string
+	// Stream, if true, encodes requests while sending them with chunked
+	// transfer encoding instead of buffering them in memory first. Each
+	// attempt of a call encodes its args again.
+	Stream bool
+	// Balancer, if non-nil, spreads calls over several endpoints instead
+	// of the URL of the client. See NewMultiClient.
+	Balancer *Balancer
+	// Interceptors wrap every call, the first one outermost.
+	Interceptors []Interceptor
+	// HTTPInterceptors wrap every HTTP exchange, the first one outermost.
+	HTTPInterceptors []HTTPInterceptor
 }
 
+// DefaultUserAgent is the User-Agent sent by clients that do not set one.
+const DefaultUserAgent = "go-xmlrpc"
+
 // NewClient create new Client
 func NewClient(url string) *Client {
 	return &Client{
@@ -450,46 +428,244 @@ func NewClient(url string) *Client {
 	}
 }
 
-func Marshal(w io.Writer, name string, args ...interface{}) error {
-	io.WriteString(w, `<?xml version="1.0"?>`)
+// EncoderOptions configures how an Encoder writes documents.
+type EncoderOptions struct {
+	// Encoding is the character encoding declared in the XML prolog and
+	// used for the output. Empty means UTF-8.
+	Encoding string
+	// CharsetWriter, if non-nil, returns a writer converting UTF-8 to
+	// Encoding. If nil, the charsets supported by CharsetWriter are used.
+	CharsetWriter func(charset string, output io.Writer) (io.Writer, error)
+	// FloatPrecision is the number of digits written after the decimal
+	// point of doubles. Zero means the fewest digits that represent the
+	// value exactly.
+	FloatPrecision int
+	// NaNPolicy controls how NaN and infinite doubles are written.
+	NaNPolicy NaNPolicy
+	// UntypedStrings writes strings as untyped values, <value>foo</value>,
+	// which the spec defines as strings, instead of in a string element.
+	UntypedStrings bool
+}
+
+// Encoder writes XMLRPC method calls and responses to an output stream.
+type Encoder struct {
+	EncoderOptions
+	w io.Writer
+
+	readBase64 bool // a Base64Reader has been read
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes a methodCall for name with args, or a methodResponse with
+// args as params if name is empty.
+func (enc *Encoder) Encode(name string, args ...interface{}) error {
+	w, err := enc.prolog()
+	if err != nil {
+		return err
+	}
+	e := newEncodeState(&enc.EncoderOptions, w)
+	defer e.free()
+	defer func() { enc.readBase64 = enc.readBase64 || e.readBase64 }()
 	var end string
 	if name == "" {
-		io.WriteString(w, "<methodResponse>")
+		e.str("<methodResponse>")
 		end = "</methodResponse>"
 	} else {
-		io.WriteString(w, "<methodCall><methodName>")
-		if err := xml.EscapeText(w, []byte(name)); err != nil {
-			return err
-		}
-		io.WriteString(w, "</methodName>")
+		e.str("<methodCall><methodName>")
+		e.text(name)
+		e.str("</methodName>")
 		end = "</methodCall>"
 	}
 
-	io.WriteString(w, "<params>")
+	e.str("<params>")
 	for _, arg := range args {
-		io.WriteString(w, "<param><value>")
-		if err := writeXML(w, arg, true); err != nil {
+		e.str("<param><value>")
+		if err := e.encode(reflect.ValueOf(arg), !enc.UntypedStrings); err != nil {
 			return err
 		}
-		io.WriteString(w, "</value></param>")
+		e.str("</value></param>")
+	}
+	e.str("</params>")
+	e.str(end)
+	return e.flush()
+}
+
+// prolog writes the XML declaration and returns the writer for the rest of
+// the document.
+func (enc *Encoder) prolog() (io.Writer, error) {
+	w := enc.w
+	if enc.Encoding == "" || strings.EqualFold(enc.Encoding, "utf-8") {
+		io.WriteString(w, `<?xml version="1.0"?>`)
+	} else {
+		charsetWriter := enc.CharsetWriter
+		if charsetWriter == nil {
+			charsetWriter = CharsetWriter
+		}
+		cw, err := charsetWriter(enc.Encoding, w)
+		if err != nil {
+			return nil, err
+		}
+		io.WriteString(w, `<?xml version="1.0" encoding="`)
+		if err := xml.EscapeText(w, []byte(enc.Encoding)); err != nil {
+			return nil, err
+		}
+		io.WriteString(w, `"?>`)
+		w = cw
 	}
-	io.WriteString(w, "</params>")
-	_, err := io.WriteString(w, end)
-	return err
+	return w, nil
+}
+
+// Marshal writes a methodCall for name with args to w, or a methodResponse
+// if name is empty.
+func Marshal(w io.Writer, name string, args ...interface{}) error {
+	return NewEncoder(w).Encode(name, args...)
 }
 
-func makeRequest(name string, args ...interface{}) *bytes.Buffer {
+func makeRequest(opts EncoderOptions, name string, args ...interface{}) (*bytes.Buffer, error) {
 	var buf bytes.Buffer
-	if err := Marshal(&buf, name, args...); err != nil {
-		panic(err)
+	enc := NewEncoder(&buf)
+	enc.EncoderOptions = opts
+	if err := enc.Encode(name, args...); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// decodeFunc decodes the response of a call. A nil decodeFunc uses
+// Decoder.Decode.
+type decodeFunc func(dec *Decoder) (Array, error)
+
+// invoke makes a call through the interceptors, decoding its response
+// with decode.
+func (c *Client) invoke(ctx context.Context, name string, args []interface{}, decode decodeFunc) (v Array, e error) {
+	return chain(c.Interceptors, func(ctx context.Context, name string, args []interface{}) (Array, error) {
+		return c.call(ctx, name, args, decode)
+	})(ctx, name, args)
+}
+
+func (c *Client) call(ctx context.Context, name string, args []interface{}, decode decodeFunc) (v Array, e error) {
+	if e = c.Concurrency.acquire(ctx); e != nil {
+		return nil, e
+	}
+	defer c.Concurrency.release()
+	if c.SessionHook != nil {
+		args = c.SessionHook(name, args)
+	}
+	var body func() (io.Reader, error)
+	if c.Stream {
+		// report an unsupported content coding before sending anything
+		if _, e = compressWriter(c.ContentEncoding, nil); e != nil {
+			return nil, e
+		}
+		body = newRequestStream(c.EncoderOptions, c.ContentEncoding, name, args).body
+	} else {
+		buf, e := makeRequest(c.EncoderOptions, name, args...)
+		if e != nil {
+			return nil, e
+		}
+		b, e := compress(c.ContentEncoding, buf.Bytes())
+		if e != nil {
+			return nil, e
+		}
+		body = func() (io.Reader, error) { return bytes.NewReader(b), nil }
 	}
-	return &buf
+	v, e = c.Retry.do(ctx, name, func(max int) (Array, int, error) {
+		if c.Balancer != nil {
+			return c.Balancer.send(ctx, c, name, body, decode, max)
+		}
+		v, e := c.send(ctx, c.url, name, body, decode)
+		return v, 1, e
+	})
+	return v, unwrapPartialError(unwrapCallerError(e))
 }
-func call(client *http.Client, url, name string, args ...interface{}) (v Array, e error) {
-	r, e := http.DefaultClient.Post(url, "text/xml", makeRequest(name, args...))
+
+// send makes a request of a call to url, once allowed by the Breaker and
+// RateLimit of c.
+func (c *Client) send(ctx context.Context, url, name string, body func() (io.Reader, error), decode decodeFunc) (Array, error) {
+	gen, e := c.Breaker.allow()
 	if e != nil {
 		return nil, e
 	}
+	if e := c.RateLimit.wait(ctx, name); e != nil {
+		c.Breaker.done(ctx, gen, e)
+		return nil, e
+	}
+	v, e := c.post(ctx, url, name, body, decode)
+	c.Breaker.done(ctx, gen, e)
+	return v, e
+}
+
+func (c *Client) post(ctx context.Context, url, name string, body func() (io.Reader, error), decode decodeFunc) (v Array, e error) {
+	contentType := "text/xml"
+	if c.EncoderOptions.Encoding != "" {
+		contentType += "; charset=" + c.EncoderOptions.Encoding
+	}
+	b, e := body()
+	if e != nil {
+		return nil, e
+	}
+	if rc, ok := b.(io.Closer); ok {
+		// ends a streamed encoding even if the request is not sent
+		defer rc.Close()
+	}
+	req, e := http.NewRequest("POST", url, b)
+	if e != nil {
+		return nil, e
+	}
+	if req.GetBody == nil {
+		// a streamed request is encoded again
+		req.GetBody = func() (io.ReadCloser, error) {
+			b, err := body()
+			if err != nil {
+				return nil, err
+			}
+			if rc, ok := b.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return nil, errors.New("request body cannot be read again")
+		}
+	}
+	req = req.WithContext(ctx)
+	for k, vs := range c.Header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.ContentEncoding != "" {
+		req.Header.Set("Content-Encoding", c.ContentEncoding)
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	} else if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", DefaultUserAgent)
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	}
+	if c.RequestHook != nil {
+		if e = c.RequestHook(req, name); e != nil {
+			return nil, e
+		}
+	}
+	client := c.HttpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r, e := chainHTTP(c.HTTPInterceptors, client.Do)(req)
+	if e != nil {
+		var ee *encodeError
+		if errors.As(e, &ee) {
+			return nil, ee.err
+		}
+		return nil, e
+	}
 
 	// Since we do not always read the entire body, discard the rest, which
 	// allows the http transport to reuse the connection.
@@ -497,56 +673,124 @@ func call(client *http.Client, url, name string, args ...interface{}) (v Array,
 	defer r.Body.Close()
 
 	if r.StatusCode/100 != 2 {
-		return nil, errors.New(http.StatusText(http.StatusBadRequest))
+		return nil, &StatusError{Code: r.StatusCode}
 	}
 
-	_, v, e = Unmarshal(r.Body)
+	rb, e := decompress(r.Header.Get("Content-Encoding"), r.Body)
+	if e != nil {
+		return nil, e
+	}
+	dec := NewDecoder(rb)
+	dec.CharsetReader = c.CharsetReader
+	if decode != nil {
+		return decode(dec)
+	}
+	_, v, e = dec.Decode()
 	return v, e
 }
 
-func Unmarshal(r io.Reader) (string, Array, error) {
+// StatusError is returned by calls answered with a non-2xx HTTP status.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, http.StatusText(e.Code))
+}
+
+// Decoder reads XMLRPC method calls and responses from an input stream.
+type Decoder struct {
+	// CharsetReader, if non-nil, returns a reader converting the charset
+	// declared by the document to UTF-8. If nil, the charsets supported
+	// by CharsetReader are used.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+	r             io.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads a methodCall or methodResponse and returns the method name,
+// empty for a response, and the params.
+func (dec *Decoder) Decode() (string, Array, error) {
+	p, name, e := dec.start(nil)
+	if e != nil {
+		return name, nil, e
+	}
+	_, v, e := next(p)
+	if a, ok := v.(Array); ok {
+		return name, a, e
+	} else if e == nil {
+		e = fmt.Errorf("wanted Array, got %#v", v)
+	}
+	return name, nil, e
+}
+
+// start reads the document up to the params and returns the method name.
+// If raw is non-nil, it is set to the reader under the returned decoder.
+func (dec *Decoder) start(raw **rawReader) (*xml.Decoder, string, error) {
 	var name string
-	p := xml.NewDecoder(r)
+	charsetReader := dec.CharsetReader
+	if charsetReader == nil {
+		charsetReader = CharsetReader
+	}
+	var p *xml.Decoder
+	if raw == nil {
+		p = xml.NewDecoder(dec.r)
+		p.CharsetReader = charsetReader
+	} else {
+		*raw = newRawReader(dec.r)
+		p = xml.NewDecoder(*raw)
+		p.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+			r, err := charsetReader(charset, input)
+			if err != nil {
+				return nil, err
+			}
+			*raw = newRawReader(r)
+			return *raw, nil
+		}
+	}
 	se, e := nextStart(p) // methodResponse
 	if e != nil {
-		return name, nil, e
+		return p, name, e
 	}
 	if se.Name.Local != "methodResponse" {
 		if se.Name.Local != "methodCall" {
-			return name, nil, errors.New("invalid response: missing methodResponse")
+			return p, name, errors.New("invalid response: missing methodResponse")
 		}
 		if se, e = nextStart(p); e != nil {
-			return name, nil, e
+			return p, name, e
 		}
 		if se.Name.Local != "methodName" {
-			return name, nil, errors.New("invalid response: missing methodName")
+			return p, name, errors.New("invalid response: missing methodName")
 		}
 		if e = p.DecodeElement(&name, se); e != nil {
-			return name, nil, e
+			return p, name, e
 		}
 	}
-	_, v, e := next(p)
-	if a, ok := v.(Array); ok {
-		return name, a, e
-	} else if e == nil {
-		e = fmt.Errorf("wanted Array, got %#v", v)
-	}
-	return name, nil, e
+	return p, name, nil
 }
 
-type Fault struct {
-	Code    int
-	Message string
+// Unmarshal reads a methodCall or methodResponse from r and returns the
+// method name, empty for a response, and the params.
+func Unmarshal(r io.Reader) (string, Array, error) {
+	return NewDecoder(r).Decode()
 }
 
-func (f *Fault) Error() string { return fmt.Sprintf("%d: %s", f.Code, f.Message) }
-
 // Call call remote procedures function name with args
 func (c *Client) Call(name string, args ...interface{}) (v Array, e error) {
-	return call(c.HttpClient, c.url, name, args...)
+	return c.invoke(context.Background(), name, args, nil)
+}
+
+// CallContext call remote procedures function name with args, aborting if
+// ctx is done
+func (c *Client) CallContext(ctx context.Context, name string, args ...interface{}) (v Array, e error) {
+	return c.invoke(ctx, name, args, nil)
 }
 
 // Call call remote procedures function name with args
 func Call(url, name string, args ...interface{}) (v Array, e error) {
-	return call(http.DefaultClient, url, name, args...)
+	return (&Client{HttpClient: http.DefaultClient, url: url}).invoke(context.Background(), name, args, nil)
 }
@@ -4,12 +4,15 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
     "bytes"
     "reflect"
+    "time"
 )
 
 func createServer(path, name string, f func(args ...interface{}) (interface{}, error)) http.HandlerFunc {
@@ -589,10 +592,358 @@ func TestArrayOfStruct(t *testing.T) {
     }    
 }
 
+func TestDoubleEncoding(t *testing.T) {
+	tests := []struct {
+		opts EncoderOptions
+		v    interface{}
+		want string
+	}{
+		{EncoderOptions{}, 1.5, "<double>1.5</double>"},
+		{EncoderOptions{}, 1e21, "<double>1000000000000000000000</double>"},
+		{EncoderOptions{}, 1e-7, "<double>0.0000001</double>"},
+		{EncoderOptions{}, float32(0.1), "<double>0.1</double>"},
+		{EncoderOptions{FloatPrecision: 3}, 2.0, "<double>2.000</double>"},
+		{EncoderOptions{FloatPrecision: 2}, float32(0.1), "<double>0.10</double>"},
+		{EncoderOptions{NaNPolicy: NaNNil}, math.NaN(), "<nil/>"},
+		{EncoderOptions{NaNPolicy: NaNString}, math.Inf(1), "<string>+Inf</string>"},
+		{EncoderOptions{NaNPolicy: NaNString}, math.Inf(-1), "<string>-Inf</string>"},
+		{EncoderOptions{NaNPolicy: NaNString}, Array{math.NaN()}, "<array><data><value><string>NaN</string></value></data></array>"},
+	}
+	for _, test := range tests {
+		var buf strings.Builder
+		if err := test.opts.writeXML(&buf, test.v, true); err != nil {
+			t.Fatalf("%v: %s", test.v, err)
+		}
+		if buf.String() != test.want {
+			t.Fatalf("want %q but got %q", test.want, buf.String())
+		}
+	}
+
+	if err := Marshal(ioutil.Discard, "", math.NaN()); err != UnsupportedFloat {
+		t.Fatalf("want %v but got %v", UnsupportedFloat, err)
+	}
+	if _, err := NewClient("http://127.0.0.1:0/").Call("Irrelevant", math.Inf(1)); err != UnsupportedFloat {
+		t.Fatalf("want %v but got %v", UnsupportedFloat, err)
+	}
+}
+
+func TestUntypedStrings(t *testing.T) {
+	var buf strings.Builder
+	enc := NewEncoder(&buf)
+	enc.UntypedStrings = true
+	if err := enc.Encode("", "  a b  ", 1, Array{"x"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "<params><param><value>  a b  </value></param>" +
+		"<param><value><int>1</int></value></param>" +
+		"<param><value><array><data><value>x</value></data></array></value></param></params>"
+	if !strings.Contains(buf.String(), want) {
+		t.Fatalf("want %q in %q", want, buf.String())
+	}
+	_, v, err := Unmarshal(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{"  a b  ", 1, Array{"x"}}) {
+		t.Fatalf("response different from expected (%+v)", v)
+	}
+
+	_, v, err = Unmarshal(strings.NewReader(`<methodResponse><params>
+		<param><value>
+			<nil/>
+		</value></param>
+		<param><value>
+			<int>2</int>
+		</value></param>
+		<param><value> </value></param>
+		<param><value></value></param>
+	</params></methodResponse>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, Array{nil, 2, " ", ""}) {
+		t.Fatalf("response different from expected (%#v)", v)
+	}
+}
+
+type Audit struct {
+	Created string
+	Author  string `xmlrpc:"author"`
+}
+
+type Owner struct {
+	Name string
+}
+
+type Bug struct {
+	Audit
+	*Owner
+	ID      int    `xmlrpc:"id"`
+	Summary string `xmlrpc:"summary"`
+	Notes   struct {
+		Text string
+	} `xmlrpc:",inline"`
+	Name     string
+	Secret   string `xmlrpc:"-"`
+	internal int
+}
+
+func TestStructFields(t *testing.T) {
+	bug := Bug{
+		Audit:    Audit{Created: "today", Author: "alice"},
+		ID:       42,
+		Summary:  "crash",
+		Name:     "top",
+		Secret:   "hidden",
+		internal: 1,
+	}
+	bug.Notes.Text = "see log"
+	enc := EncoderOptions{UntypedStrings: true}
+	var buf strings.Builder
+	if err := enc.writeXML(&buf, bug, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "<struct>" +
+		"<member><name>Created</name><value>today</value></member>" +
+		"<member><name>author</name><value>alice</value></member>" +
+		"<member><name>id</name><value><int>42</int></value></member>" +
+		"<member><name>summary</name><value>crash</value></member>" +
+		"<member><name>Text</name><value>see log</value></member>" +
+		"<member><name>Name</name><value>top</value></member>" +
+		"</struct>"
+	if buf.String() != want {
+		t.Fatalf("want %q but got %q", want, buf.String())
+	}
+
+	var got Bug
+	v := Struct{"Created": "today", "author": "alice", "ID": 42, "Text": "see log", "Name": "top", "Secret": "x"}
+	if err := assign(reflect.ValueOf(&got).Elem(), v); err != nil {
+		t.Fatal(err)
+	}
+	want2 := Bug{Audit: Audit{Created: "today", Author: "alice"}, ID: 42, Name: "top"}
+	want2.Notes.Text = "see log"
+	if !reflect.DeepEqual(got, want2) {
+		t.Fatalf("want %+v but got %+v", want2, got)
+	}
+}
+
+func TestEncodeTime(t *testing.T) {
+	when := time.Date(1998, 7, 17, 14, 8, 55, 0, time.UTC)
+	type Event struct {
+		At   time.Time
+		Prev *time.Time
+	}
+	v := Event{At: when, Prev: &when}
+	want := "<struct><member><name>At</name><value><dateTime.iso8601>19980717T14:08:55</dateTime.iso8601></value></member>" +
+		"<member><name>Prev</name><value><dateTime.iso8601>19980717T14:08:55</dateTime.iso8601></value></member></struct>"
+	if got := toXml(v, true); got != want {
+		t.Fatalf("want %q but got %q", want, got)
+	}
+
+	var buf bytes.Buffer
+	if err := Marshal(&buf, "", v); err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := Unmarshal(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Event
+	if err := assign(reflect.ValueOf(&got).Elem(), params[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !got.At.Equal(when) || got.Prev == nil || !got.Prev.Equal(when) {
+		t.Fatalf("want %v but got %+v", when, got)
+	}
+}
+
+func TestEncodePointersAndInterfaces(t *testing.T) {
+	type Key string
+	n := 7
+	pn := &n
+	var nilPtr *int
+	var iface interface{} = &pn
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{&n, "<int>7</int>"},
+		{&pn, "<int>7</int>"},
+		{nilPtr, "<nil/>"},
+		{[]interface{}{iface, nil, nilPtr}, "<array><data><value><int>7</int></value><value><nil/></value><value><nil/></value></data></array>"},
+		{map[Key]interface{}{"k": []*int{pn}}, "<struct><member><name>k</name><value><array><data><value><int>7</int></value></data></array></value></member></struct>"},
+		{struct{ V interface{} }{Struct{"x": &n}}, "<struct><member><name>V</name><value><struct><member><name>x</name><value><int>7</int></value></member></struct></value></member></struct>"},
+		{[2]uint8{1, 2}, "<array><data><value><int>1</int></value><value><int>2</int></value></data></array>"},
+	}
+	for _, test := range tests {
+		if got := toXml(test.v, true); got != test.want {
+			t.Fatalf("%#v: want %q but got %q", test.v, test.want, got)
+		}
+	}
+
+	for _, v := range []interface{}{make(chan int), map[int]int{1: 1}, []interface{}{complex(1, 2)}} {
+		if err := new(EncoderOptions).writeXML(ioutil.Discard, v, true); err != UnsupportedType {
+			t.Fatalf("%#v: want %v but got %v", v, UnsupportedType, err)
+		}
+	}
+}
+
+func TestEncodeEscaping(t *testing.T) {
+	for _, s := range []string{"plain", "<a href=\"x\">'&'</a>", "tab\tline\r\n", "h\u00e9llo \u4e16\u754c", "bad\xffutf8", "ctrl\x01\x00", "\U0001F600"} {
+		var want bytes.Buffer
+		xml.EscapeText(&want, []byte(s))
+		if got := string(appendEscaped(nil, s)); got != want.String() {
+			t.Fatalf("%q: want %q but got %q", s, want.String(), got)
+		}
+	}
+}
+
+type treeNode struct {
+	Value    int
+	Children []*treeNode
+}
+
+func TestEncodeRecursiveType(t *testing.T) {
+	tree := &treeNode{Value: 1, Children: []*treeNode{{Value: 2}}}
+	want := "<struct><member><name>Value</name><value><int>1</int></value></member>" +
+		"<member><name>Children</name><value><array><data><value>" +
+		"<struct><member><name>Value</name><value><int>2</int></value></member>" +
+		"<member><name>Children</name><value><array><data></data></array></value></member></struct>" +
+		"</value></data></array></value></member></struct>"
+	if got := toXml(tree, true); got != want {
+		t.Fatalf("want %q but got %q", want, got)
+	}
+}
+
+func TestEncodeCycle(t *testing.T) {
+	node := &treeNode{Value: 1}
+	node.Children = []*treeNode{node}
+	m := Struct{}
+	m["self"] = m
+	a := Array{nil}
+	a[0] = a
+	var iface interface{}
+	iface = &iface
+	for _, v := range []interface{}{node, m, a, iface} {
+		if err := Marshal(ioutil.Discard, "", v); err != UnsupportedCycle {
+			t.Fatalf("%T: want %v but got %v", v, UnsupportedCycle, err)
+		}
+	}
+
+	deep := &treeNode{}
+	for i := 0; i < 2000; i++ {
+		deep = &treeNode{Value: i, Children: []*treeNode{deep}}
+	}
+	if err := Marshal(ioutil.Discard, "", deep); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		Marshal(w, "", true)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	if _, err := client.Call("Irrelevant"); err != nil {
+		t.Fatal(err)
+	}
+	if ua := header.Get("User-Agent"); ua != DefaultUserAgent {
+		t.Fatalf("want User-Agent %q but got %q", DefaultUserAgent, ua)
+	}
+	if auth := header.Get("Authorization"); auth != "" {
+		t.Fatalf("want no Authorization but got %q", auth)
+	}
+
+	client.Username = "user"
+	client.Password = "secret"
+	client.Header = http.Header{"X-Api-Key": {"key"}}
+	client.UserAgent = "test-agent"
+	client.RequestHook = func(req *http.Request, method string) error {
+		req.Header.Set("X-Method", method)
+		return nil
+	}
+	if _, err := client.Call("Irrelevant"); err != nil {
+		t.Fatal(err)
+	}
+	if user, pass, ok := (&http.Request{Header: header}).BasicAuth(); !ok || user != "user" || pass != "secret" {
+		t.Fatalf("unexpected basic auth %q", header.Get("Authorization"))
+	}
+	if header.Get("X-Api-Key") != "key" || header.Get("X-Method") != "Irrelevant" || header.Get("User-Agent") != "test-agent" {
+		t.Fatalf("unexpected headers %v", header)
+	}
+
+	client.Username = ""
+	client.BearerToken = "token"
+	if _, err := client.Call("Irrelevant"); err != nil {
+		t.Fatal(err)
+	}
+	if auth := header.Get("Authorization"); auth != "Bearer token" {
+		t.Fatalf("want bearer token but got %q", auth)
+	}
+
+	hookErr := errors.New("hook failed")
+	client.RequestHook = func(req *http.Request, method string) error { return hookErr }
+	if _, err := client.Call("Irrelevant"); err != hookErr {
+		t.Fatalf("want %v but got %v", hookErr, err)
+	}
+}
+
 func toXml(v interface{}, typ bool) (s string) {
 	var buf strings.Builder
-	if err := writeXML(&buf, v, typ); err != nil {
+	if err := new(EncoderOptions).writeXML(&buf, v, typ); err != nil {
 		panic(err)
 	}
 	return buf.String()
 }
+
+type benchBug struct {
+	ID       int     `xmlrpc:"id"`
+	Summary  string  `xmlrpc:"summary"`
+	Priority float64 `xmlrpc:"priority"`
+	Open     bool    `xmlrpc:"is_open"`
+	Tags     []string
+	Extra    Struct
+}
+
+func benchResponse() Array {
+	bugs := make([]benchBug, 100)
+	for i := range bugs {
+		bugs[i] = benchBug{
+			ID:       i,
+			Summary:  "Crash when <saving> a file & reopening it",
+			Priority: float64(i) / 3,
+			Open:     i%2 == 0,
+			Tags:     []string{"crash", "regression"},
+			Extra:    Struct{"component": "editor", "votes": i},
+		}
+	}
+	return Array{Struct{"bugs": bugs, "total": len(bugs)}}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	v := benchResponse()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := Marshal(ioutil.Discard, "", v...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalBase64(b *testing.B) {
+	blobs := make([][]byte, 100)
+	for i := range blobs {
+		blobs[i] = bytes.Repeat([]byte{byte(i)}, 1024)
+	}
+	b.ReportAllocs()
+	b.SetBytes(100 * 1024)
+	for i := 0; i < b.N; i++ {
+		if err := Marshal(ioutil.Discard, "", blobs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}